@@ -19,17 +19,26 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/banzaicloud/allspark/internal/kafka"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/banzaicloud/allspark/internal/admin"
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/generate"
 	"github.com/banzaicloud/allspark/internal/grpcserver"
 	"github.com/banzaicloud/allspark/internal/httpserver"
+	"github.com/banzaicloud/allspark/internal/loadgen"
 	"github.com/banzaicloud/allspark/internal/platform/healthcheck"
 	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+	"github.com/banzaicloud/allspark/internal/scheduler"
 	"github.com/banzaicloud/allspark/internal/tcpserver"
+	"github.com/banzaicloud/allspark/internal/topology"
+	"github.com/banzaicloud/allspark/internal/udpserver"
 )
 
 // main configuration
@@ -59,8 +68,62 @@ type Config struct {
 	// TCP server configuration
 	TCPServer tcpserver.Config `mapstructure:"tcpServer"`
 
+	// UDP server configuration
+	UDPServer udpserver.Config `mapstructure:"udpServer"`
+
 	// Kafka server consumer configurations
 	KafkaServer kafka.Consumer `mapstructure:"kafkaServer"`
+
+	// Fault injection configuration
+	Fault fault.Config `mapstructure:"fault"`
+
+	// Admin API configuration
+	Admin admin.Config `mapstructure:"admin"`
+
+	// Graceful shutdown configuration
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+
+	// Scheduler configuration
+	Scheduler scheduler.Config `mapstructure:"scheduler"`
+
+	// Topology configuration
+	Topology topology.Config `mapstructure:"topology"`
+
+	// Load generator configuration
+	Loadgen loadgen.Config `mapstructure:"loadgen"`
+
+	// Manifest generator configuration
+	Generate generate.Config `mapstructure:"generate"`
+
+	// Default proxy of the outgoing requests
+	Proxy request.ProxyConfig `mapstructure:"proxy"`
+}
+
+// ShutdownConfig holds the settings of the graceful shutdown
+type ShutdownConfig struct {
+	// PreStopDelay is the time to wait after readiness is flipped to failing
+	// and before the servers start draining, so load balancers can catch up
+	PreStopDelay time.Duration `mapstructure:"preStopDelay"`
+
+	// Timeout is the deadline for draining the servers
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Validate validates the shutdown configuration
+func (c ShutdownConfig) Validate() (ShutdownConfig, error) {
+	if c.PreStopDelay < 0 {
+		return c, errors.New("pre-stop delay must not be negative")
+	}
+
+	if c.Timeout < 0 {
+		return c, errors.New("shutdown timeout must not be negative")
+	}
+
+	if c.Timeout == 0 {
+		c.Timeout = 20 * time.Second
+	}
+
+	return c, nil
 }
 
 // Validate validates the configuration
@@ -95,12 +158,80 @@ func (c Config) Validate() (Config, error) {
 	}
 	c.TCPServer = tcpServerConfig
 
+	udpServerConfig, err := c.UDPServer.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate UDP server config")
+	}
+	c.UDPServer = udpServerConfig
+
 	kafkaServerConfig, err := c.KafkaServer.Validate()
 	if err != nil {
 		return c, errors.WrapIf(err, "could not validate kafka server config")
 	}
 	c.KafkaServer = *kafkaServerConfig
 
+	faultConfig, err := c.Fault.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate fault config")
+	}
+	c.Fault = faultConfig
+
+	adminConfig, err := c.Admin.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate admin config")
+	}
+	c.Admin = adminConfig
+
+	// the admin API shares the router of the health checks, which panics on colliding routes
+	if c.Admin.Enabled {
+		for _, e := range []struct{ key, endpoint string }{
+			{"healthcheck.endpoint", c.Healthcheck.Endpoint},
+			{"healthcheck.livenessEndpoint", c.Healthcheck.LivenessEndpoint},
+			{"healthcheck.readinessEndpoint", c.Healthcheck.ReadinessEndpoint},
+			{"healthcheck.startupEndpoint", c.Healthcheck.StartupEndpoint},
+		} {
+			if e.endpoint == c.Admin.Endpoint || strings.HasPrefix(e.endpoint, strings.TrimSuffix(c.Admin.Endpoint, "/")+"/") {
+				return c, errors.Errorf("admin.endpoint and %s must not overlap: '%s' and '%s'", e.key, c.Admin.Endpoint, e.endpoint)
+			}
+		}
+	}
+
+	shutdownConfig, err := c.Shutdown.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate shutdown config")
+	}
+	c.Shutdown = shutdownConfig
+
+	schedulerConfig, err := c.Scheduler.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate scheduler config")
+	}
+	c.Scheduler = schedulerConfig
+
+	topologyConfig, err := c.Topology.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate topology config")
+	}
+	c.Topology = topologyConfig
+
+	loadgenConfig, err := c.Loadgen.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate loadgen config")
+	}
+	c.Loadgen = loadgenConfig
+
+	generateConfig, err := c.Generate.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate generate config")
+	}
+	c.Generate = generateConfig
+
+	proxyConfig, err := c.Proxy.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "could not validate proxy config")
+	}
+	c.Proxy = proxyConfig
+
 	return c, nil
 }
 
@@ -113,6 +244,13 @@ func configure() {
 		panic(errors.WrapIf(err, "failed to read configuration"))
 	}
 	bindEnvs(configuration)
+	// the generate and simulate commands use the whole topology instead of a single service
+	if command := pflag.Arg(0); command != "generate" && command != "simulate" {
+		err = applyTopology(viper.GetViper())
+		if err != nil {
+			panic(errors.WrapIf(err, "failed to apply topology"))
+		}
+	}
 	err = viper.Unmarshal(&configuration)
 	if err != nil {
 		panic(errors.WrapIf(err, "failed to unmarshal configuration"))
@@ -132,6 +270,10 @@ func setupViper(v *viper.Viper, p *pflag.FlagSet) {
 	p.Init(FriendlyServiceName, pflag.ExitOnError)
 	pflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", FriendlyServiceName)
+		fmt.Fprintf(os.Stderr, "  allspark [flags]           run the servers\n")
+		fmt.Fprintf(os.Stderr, "  allspark loadgen [flags]   generate load with the configured requests\n")
+		fmt.Fprintf(os.Stderr, "  allspark generate [flags]  generate Kubernetes manifests from the topology\n")
+		fmt.Fprintf(os.Stderr, "  allspark simulate [flags]  run every service of the topology in one process\n\n")
 		pflag.PrintDefaults()
 	}
 	v.BindPFlags(p) // nolint:errcheck
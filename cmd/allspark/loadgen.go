@@ -0,0 +1,55 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/loadgen"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+)
+
+// runLoadgen sends the requests according to the load generator configuration
+// and writes the report, an interrupt finishes the run early
+func runLoadgen(config loadgen.Config, requests request.Requests, logger log.Logger) error {
+	generator, err := loadgen.New(config, requests, logger)
+	if err != nil {
+		return errors.WrapIf(err, "could not create load generator")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report := generator.Run(ctx)
+
+	var w io.Writer = os.Stdout
+	if config.ReportFile != "" {
+		f, err := os.Create(config.ReportFile)
+		if err != nil {
+			return errors.WrapIf(err, "could not create report file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return errors.WrapIf(report.Write(w, config.Report), "could not write report")
+}
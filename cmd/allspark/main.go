@@ -15,9 +15,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
@@ -27,14 +31,18 @@ import (
 	"github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
 
+	"github.com/banzaicloud/allspark/internal/admin"
+	"github.com/banzaicloud/allspark/internal/fault"
 	"github.com/banzaicloud/allspark/internal/grpcserver"
 	"github.com/banzaicloud/allspark/internal/httpserver"
 	"github.com/banzaicloud/allspark/internal/platform/errorhandler"
 	"github.com/banzaicloud/allspark/internal/platform/healthcheck"
 	"github.com/banzaicloud/allspark/internal/platform/log"
 	"github.com/banzaicloud/allspark/internal/request"
+	"github.com/banzaicloud/allspark/internal/scheduler"
 	"github.com/banzaicloud/allspark/internal/sql"
 	"github.com/banzaicloud/allspark/internal/tcpserver"
+	"github.com/banzaicloud/allspark/internal/udpserver"
 	"github.com/banzaicloud/allspark/internal/workload"
 )
 
@@ -72,12 +80,24 @@ func main() {
 	errorHandler := errorhandler.ErrorHandler(logger)
 	defer emperror.HandleRecover(errorHandler)
 
+	if pflag.Arg(0) == "generate" {
+		if err := runGenerate(configuration.Generate, configuration.Topology.File, logger); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	logger.Infof("starting %s", FriendlyServiceName)
 
-	// Starts health check HTTP server
-	go func() {
-		healthcheck.New(configuration.Healthcheck, logger, errorHandler)
-	}()
+	if configuration.Topology.Service != "" {
+		logger.WithFields(log.Fields{
+			"file":    configuration.Topology.File,
+			"service": configuration.Topology.Service,
+		}).Info("topology service resolved")
+	}
+
+	// Creates health check HTTP server
+	hc := healthcheck.New(configuration.Healthcheck, logger, errorHandler)
 
 	var err error
 	var sqlClient *sql.Client
@@ -98,34 +118,71 @@ func main() {
 		}).Info("SQL client initialized")
 	}
 
+	if configuration.Healthcheck.Checks.SQL {
+		if sqlClient == nil {
+			panic(errors.New("SQL readiness check is enabled but SQL client is not configured"))
+		}
+		hc.AddReadinessCheck("sql", sqlClient.Ping)
+	}
+	for _, bootstrapServer := range configuration.Healthcheck.Checks.Kafka {
+		bootstrapServer := bootstrapServer
+		hc.AddReadinessCheck("kafka:"+bootstrapServer, func(ctx context.Context) error {
+			return kafka.CheckBroker(ctx, bootstrapServer)
+		})
+	}
+
+	request.SetDefaultProxy(configuration.Proxy)
+
 	requests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("requests"), logger.WithField("server", "any"))
 	if err != nil {
 		panic(err)
 	}
 
-	var wl workload.Workload
-	switch viper.GetString("workload") {
-	case "Echo":
-		str := viper.GetString("ECHO_STR")
-		wl = workload.NewEchoWorkload(str, logger)
-	case "PI":
-		count := viper.GetInt("PI_COUNT")
-		if count < 1 {
-			count = 50000
+	if pflag.Arg(0) == "loadgen" {
+		loadgenRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("loadgenRequests"), logger.WithField("server", "loadgen"))
+		if err != nil {
+			panic(err)
+		}
+		if len(loadgenRequests) == 0 {
+			loadgenRequests = requests
+		}
+
+		if err := runLoadgen(configuration.Loadgen, loadgenRequests, logger); err != nil {
+			panic(err)
 		}
-		wl = workload.NewPIWorkload(uint(count), logger)
+		return
 	}
 
-	var wg sync.WaitGroup
+	if pflag.Arg(0) == "simulate" {
+		servers, err := simulationServers(configuration, hc, sqlClient, logger, errorHandler)
+		if err != nil {
+			panic(err)
+		}
+
+		serve(configuration.Shutdown, hc, servers, logger, errorHandler)
+		return
+	}
+
+	initialWorkload, err := workload.New(workload.Config{
+		Name:    viper.GetString("workload"),
+		EchoStr: viper.GetString("ECHO_STR"),
+		PICount: viper.GetInt("PI_COUNT"),
+	}, logger)
+	if err != nil {
+		panic(err)
+	}
+	wl := workload.NewDynamicWorkload(initialWorkload, logger)
+
+	faultInjector := fault.NewInjector(configuration.Fault, logger)
+
+	servers := make([]inboundServer, 0)
+	var grpcServer *grpcserver.Server
 
 	// HTTP server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	{
 		srv := httpserver.New(configuration.HTTPServer, logger, errorHandler)
-		if wl != nil {
-			srv.SetWorkload(wl)
-		}
+		srv.SetWorkload(wl)
+		srv.SetFaultInjector(faultInjector)
 
 		httpRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("httpRequests"), logger.WithField("server", "http"))
 		if err != nil {
@@ -137,17 +194,14 @@ func main() {
 
 		srv.SetRequests(httpRequests)
 		srv.SetSQLClient(sqlClient)
-		srv.Run()
-	}()
+		servers = append(servers, srv)
+	}
 
 	// GRPC server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	{
 		srv := grpcserver.New(configuration.GRPCServer, logger, errorHandler)
-		if wl != nil {
-			srv.SetWorkload(wl)
-		}
+		srv.SetWorkload(wl)
+		srv.SetFaultInjector(faultInjector)
 
 		grpcRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("grpcRequests"), logger.WithField("server", "grpc"))
 		if err != nil {
@@ -159,17 +213,16 @@ func main() {
 
 		srv.SetRequests(grpcRequests)
 		srv.SetSQLClient(sqlClient)
-		srv.Run()
-	}()
+		srv.SetReadinessCheck(hc.CheckReadiness)
+		servers = append(servers, srv)
+		grpcServer = srv
+	}
 
 	// TCP server
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	{
 		srv := tcpserver.New(configuration.TCPServer, logger, errorHandler)
-		if wl != nil {
-			srv.SetWorkload(wl)
-		}
+		srv.SetWorkload(wl)
+		srv.SetFaultInjector(faultInjector)
 
 		tcpRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("tcpRequests"), logger.WithField("server", "tcp"))
 		if err != nil {
@@ -181,32 +234,131 @@ func main() {
 
 		srv.SetRequests(tcpRequests)
 		srv.SetSQLClient(sqlClient)
-		srv.Run()
-	}()
+		servers = append(servers, srv)
+	}
+
+	// UDP server
+	{
+		srv := udpserver.New(configuration.UDPServer, logger, errorHandler)
+		srv.SetWorkload(wl)
+		srv.SetFaultInjector(faultInjector)
+
+		udpRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("udpRequests"), logger.WithField("server", "udp"))
+		if err != nil {
+			panic(err)
+		}
+		if len(udpRequests) == 0 {
+			udpRequests = requests
+		}
+
+		srv.SetRequests(udpRequests)
+		srv.SetSQLClient(sqlClient)
+		servers = append(servers, srv)
+	}
+
+	// Scheduler
+	if configuration.Scheduler.Enabled() {
+		srv, err := scheduler.New(configuration.Scheduler, logger, errorHandler)
+		if err != nil {
+			panic(err)
+		}
+		srv.SetWorkload(wl)
+
+		schedulerRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("schedulerRequests"), logger.WithField("server", "scheduler"))
+		if err != nil {
+			panic(err)
+		}
+		if len(schedulerRequests) == 0 {
+			schedulerRequests = requests
+		}
+
+		srv.SetRequests(schedulerRequests)
+		srv.SetSQLClient(sqlClient)
+		servers = append(servers, srv)
+	}
 
 	// Kafka server
 	if configuration.KafkaServer.BootstrapServer != "" {
+		consumer := kafka.NewConsumer(configuration.KafkaServer.BootstrapServer, configuration.KafkaServer.Topic, configuration.KafkaServer.ConsumerGroup, logger)
+		srv := server.New(consumer, logger, errorHandler)
+		srv.SetWorkload(wl)
+		srv.SetFaultInjector(faultInjector)
+
+		kafkaRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("kafkaRequests"), logger.WithField("server", "kafka"))
+		if err != nil {
+			panic(err)
+		}
+		if len(kafkaRequests) == 0 {
+			kafkaRequests = requests
+		}
+
+		srv.SetRequests(kafkaRequests)
+		srv.SetSQLClient(sqlClient)
+		servers = append(servers, srv)
+	}
+
+	if configuration.Admin.Enabled {
+		adminAPI := admin.New(configuration.Admin, hc, faultInjector, wl, logger)
+		adminAPI.SetGRPCHealth(grpcServer)
+		hc.AddRoutes(adminAPI.Register)
+	}
+
+	serve(configuration.Shutdown, hc, servers, logger, errorHandler)
+}
+
+// inboundServer is implemented by every inbound server that can be drained gracefully
+type inboundServer interface {
+	Run()
+	Shutdown(ctx context.Context) error
+}
+
+// serve runs the health check and the inbound servers until an interrupt,
+// then shuts them down gracefully
+func serve(config ShutdownConfig, hc *healthcheck.Server, servers []inboundServer, logger log.Logger, errorHandler emperror.Handler) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go hc.Run()
+	for _, srv := range servers {
+		go srv.Run()
+	}
+
+	<-ctx.Done()
+	// restore the default signal handling so a second signal terminates the process immediately
+	stop()
+
+	shutdown(config, hc, servers, logger, errorHandler)
+}
+
+// shutdown flips readiness to failing, waits for the pre-stop delay, then
+// drains all servers within the configured timeout
+func shutdown(config ShutdownConfig, hc *healthcheck.Server, servers []inboundServer, logger log.Logger, errorHandler emperror.Handler) {
+	logger.WithFields(log.Fields{
+		"preStopDelay": config.PreStopDelay,
+		"timeout":      config.Timeout,
+	}).Info("shutting down")
+
+	hc.SetReady(false)
+	time.Sleep(config.PreStopDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
 		wg.Add(1)
-		go func() {
+		go func(srv inboundServer) {
 			defer wg.Done()
-			consumer := kafka.NewConsumer(configuration.KafkaServer.BootstrapServer, configuration.KafkaServer.Topic, configuration.KafkaServer.ConsumerGroup, logger)
-			srv := server.New(consumer, logger, errorHandler)
-			if wl != nil {
-				srv.SetWorkload(wl)
-			}
-
-			kafkaRequests, err := request.CreateRequestsFromStringSlice(viper.GetStringSlice("kafkaRequests"), logger.WithField("server", "kafka"))
-			if err != nil {
-				panic(err)
+			if err := srv.Shutdown(ctx); err != nil {
+				errorHandler.Handle(err)
 			}
-			if len(kafkaRequests) == 0 {
-				kafkaRequests = requests
-			}
-
-			srv.SetRequests(kafkaRequests)
-			srv.SetSQLClient(sqlClient)
-			srv.Run()
-		}()
+		}(srv)
 	}
 	wg.Wait()
+
+	if err := hc.Shutdown(ctx); err != nil {
+		errorHandler.Handle(err)
+	}
+
+	logger.Infof("%s stopped", FriendlyServiceName)
 }
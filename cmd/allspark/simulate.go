@@ -0,0 +1,137 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/grpcserver"
+	"github.com/banzaicloud/allspark/internal/httpserver"
+	"github.com/banzaicloud/allspark/internal/platform/healthcheck"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+	"github.com/banzaicloud/allspark/internal/sql"
+	"github.com/banzaicloud/allspark/internal/tcpserver"
+	"github.com/banzaicloud/allspark/internal/topology"
+	"github.com/banzaicloud/allspark/internal/udpserver"
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+// simulationHost is the address every simulated service listens on and is called at
+const simulationHost = "127.0.0.1"
+
+// simulationServers creates the servers of every service of the topology in
+// one process, each service listens on its own ports and has its own
+// workload, fault injector and requests, logged as the instance field
+func simulationServers(config Config, hc *healthcheck.Server, sqlClient *sql.Client, logger log.Logger, errorHandler emperror.Handler) ([]inboundServer, error) {
+	if config.Topology.File == "" {
+		return nil, errors.New("topology file is required to simulate services")
+	}
+
+	t, err := topology.Load(config.Topology.File)
+	if err != nil {
+		return nil, err
+	}
+	t, err = t.Local(simulationHost, config.Topology.BasePort)
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not allocate the ports of the services")
+	}
+
+	servers := make([]inboundServer, 0)
+	for _, name := range t.ServiceNames() {
+		service := t.Services[name]
+		logger := logger.WithField("instance", name)
+
+		definitions, err := t.Requests(service)
+		if err != nil {
+			return nil, emperror.With(err, "service", name)
+		}
+		requests, err := request.CreateRequestsFromStringSlice(definitions, logger.WithField("server", "any"))
+		if err != nil {
+			return nil, emperror.With(err, "service", name)
+		}
+
+		initialWorkload, err := workload.New(service.Workload, logger)
+		if err != nil {
+			return nil, emperror.With(err, "service", name)
+		}
+		wl := workload.NewDynamicWorkload(initialWorkload, logger)
+
+		faultInjector := fault.NewInjector(config.Fault, logger)
+
+		address := func(protocol string) string {
+			return fmt.Sprintf("%s:%d", simulationHost, service.Port(protocol))
+		}
+
+		fields := log.Fields{}
+
+		if service.Serves(topology.ProtocolHTTP) {
+			serverConfig := config.HTTPServer
+			serverConfig.ListenAddress = address(topology.ProtocolHTTP)
+			srv := httpserver.New(serverConfig, logger, errorHandler)
+			srv.SetWorkload(wl)
+			srv.SetFaultInjector(faultInjector)
+			srv.SetRequests(requests)
+			srv.SetSQLClient(sqlClient)
+			servers = append(servers, srv)
+			fields[topology.ProtocolHTTP] = serverConfig.ListenAddress
+		}
+
+		if service.Serves(topology.ProtocolGRPC) {
+			serverConfig := config.GRPCServer
+			serverConfig.ListenAddress = address(topology.ProtocolGRPC)
+			srv := grpcserver.New(serverConfig, logger, errorHandler)
+			srv.SetWorkload(wl)
+			srv.SetFaultInjector(faultInjector)
+			srv.SetRequests(requests)
+			srv.SetSQLClient(sqlClient)
+			srv.SetReadinessCheck(hc.CheckReadiness)
+			servers = append(servers, srv)
+			fields[topology.ProtocolGRPC] = serverConfig.ListenAddress
+		}
+
+		if service.Serves(topology.ProtocolTCP) {
+			serverConfig := config.TCPServer
+			serverConfig.ListenAddress = address(topology.ProtocolTCP)
+			srv := tcpserver.New(serverConfig, logger, errorHandler)
+			srv.SetWorkload(wl)
+			srv.SetFaultInjector(faultInjector)
+			srv.SetRequests(requests)
+			srv.SetSQLClient(sqlClient)
+			servers = append(servers, srv)
+			fields[topology.ProtocolTCP] = serverConfig.ListenAddress
+		}
+
+		if service.Serves(topology.ProtocolUDP) {
+			serverConfig := config.UDPServer
+			serverConfig.ListenAddress = address(topology.ProtocolUDP)
+			srv := udpserver.New(serverConfig, logger, errorHandler)
+			srv.SetWorkload(wl)
+			srv.SetFaultInjector(faultInjector)
+			srv.SetRequests(requests)
+			srv.SetSQLClient(sqlClient)
+			servers = append(servers, srv)
+			fields[topology.ProtocolUDP] = serverConfig.ListenAddress
+		}
+
+		logger.WithFields(fields).Info("simulated service created")
+	}
+
+	return servers, nil
+}
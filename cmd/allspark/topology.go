@@ -0,0 +1,155 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/spf13/viper"
+
+	"github.com/banzaicloud/allspark/internal/generate"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/topology"
+)
+
+// applyTopology looks up the service in the topology file and uses its
+// settings as defaults, so environment variables and the configuration file
+// still take precedence
+func applyTopology(v *viper.Viper) error {
+	file := v.GetString("topology.file")
+	if file == "" {
+		return nil
+	}
+
+	t, err := topology.Load(file)
+	if err != nil {
+		return err
+	}
+
+	name, service, err := t.Lookup(v.GetString("topology.service"), os.Getenv("SERVICE_NAME"), os.Getenv("POD_NAME"))
+	if err != nil {
+		return err
+	}
+	v.SetDefault("topology.service", name)
+
+	settings, err := topologySettings(t, service)
+	if err != nil {
+		return emperror.With(err, "service", name)
+	}
+	for key, value := range settings {
+		v.SetDefault(key, value)
+	}
+
+	return nil
+}
+
+// topologySettings returns the configuration keys and values of a service
+func topologySettings(t topology.Topology, service topology.Service) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+
+	requests, err := t.Requests(service)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) > 0 {
+		settings["requests"] = requests
+	}
+
+	if service.Workload.Name != "" {
+		settings["workload"] = service.Workload.Name
+		if service.Workload.EchoStr != "" {
+			settings["echo_str"] = service.Workload.EchoStr
+		}
+		if service.Workload.PICount != 0 {
+			settings["pi_count"] = service.Workload.PICount
+		}
+	}
+
+	for protocol, key := range map[string]string{
+		topology.ProtocolHTTP: "httpServer.listenAddress",
+		topology.ProtocolGRPC: "grpcServer.listenAddress",
+		topology.ProtocolTCP:  "tcpServer.listenAddress",
+		topology.ProtocolUDP:  "udpServer.listenAddress",
+	} {
+		if port, ok := service.Ports[protocol]; ok {
+			settings[key] = fmt.Sprintf("0.0.0.0:%d", port)
+		}
+	}
+
+	return settings, nil
+}
+
+// topologyEnv returns the settings of a service as environment variables
+func topologyEnv(t topology.Topology, service topology.Service) (map[string]string, error) {
+	settings, err := topologySettings(t, service)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string, len(settings))
+	for key, value := range settings {
+		name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if ConfigEnvPrefix != "" {
+			name = ConfigEnvPrefix + "_" + name
+		}
+
+		switch v := value.(type) {
+		case []string:
+			// string slices are split by whitespace when read from the environment
+			for _, item := range v {
+				if strings.ContainsAny(item, " \t\n") {
+					return nil, emperror.With(errors.New("value with whitespace can not be set as environment variable"), "key", key, "value", item)
+				}
+			}
+			env[name] = strings.Join(v, " ")
+		default:
+			env[name] = fmt.Sprint(v)
+		}
+	}
+
+	return env, nil
+}
+
+// runGenerate writes the Kubernetes manifests of every service of the topology
+func runGenerate(config generate.Config, file string, logger log.Logger) error {
+	if file == "" {
+		return errors.New("topology file is required to generate manifests")
+	}
+
+	t, err := topology.Load(file)
+	if err != nil {
+		return err
+	}
+
+	files, err := generate.Manifests(config, t, topologyEnv)
+	if err != nil {
+		return errors.WrapIf(err, "could not generate manifests")
+	}
+
+	if err := generate.Write(config.OutputDir, files); err != nil {
+		return err
+	}
+
+	logger.WithFields(log.Fields{
+		"directory": config.OutputDir,
+		"services":  len(files),
+	}).Info("manifests generated")
+
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/platform/healthcheck"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+// GRPCHealth is implemented by servers exposing the GRPC health checking protocol
+type GRPCHealth interface {
+	SetServingStatus(service string, servingStatus string) error
+	ServingStatuses(ctx context.Context) map[string]string
+}
+
+// API exposes the runtime state of the service for inspection and modification
+type API struct {
+	endpoint string
+
+	health   *healthcheck.Server
+	injector *fault.Injector
+	workload *workload.DynamicWorkload
+
+	grpcHealth GRPCHealth
+
+	logger log.Logger
+}
+
+type healthRequest struct {
+	Ready *bool `json:"ready"`
+	Live  *bool `json:"live"`
+}
+
+type grpcHealthRequest struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+}
+
+type faultRequest struct {
+	Enabled   *bool    `json:"enabled"`
+	Latency   *string  `json:"latency"`
+	ErrorRate *float64 `json:"errorRate"`
+	ErrorCode *int     `json:"errorCode"`
+}
+
+func New(config Config, health *healthcheck.Server, injector *fault.Injector, workload *workload.DynamicWorkload, logger log.Logger) *API {
+	return &API{
+		endpoint: config.Endpoint,
+
+		health:   health,
+		injector: injector,
+		workload: workload,
+
+		logger: logger.WithField("server", "admin"),
+	}
+}
+
+// SetGRPCHealth enables changing the GRPC health service statuses through the API
+func (a *API) SetGRPCHealth(grpcHealth GRPCHealth) {
+	a.grpcHealth = grpcHealth
+}
+
+// Register registers the admin routes on the given router
+func (a *API) Register(r gin.IRouter) {
+	g := r.Group(a.endpoint)
+	g.GET("/state", a.getState)
+	g.PUT("/health", a.setHealth)
+	g.PUT("/fault", a.setFault)
+	g.DELETE("/fault", a.disableFault)
+	g.PUT("/workload", a.setWorkload)
+	if a.grpcHealth != nil {
+		g.GET("/grpc-health", a.getGRPCHealth)
+		g.PUT("/grpc-health", a.setGRPCHealth)
+	}
+
+	a.logger.WithField("endpoint", a.endpoint).Info("admin API registered")
+}
+
+func (a *API) getState(c *gin.Context) {
+	c.JSON(http.StatusOK, a.state())
+}
+
+func (a *API) setHealth(c *gin.Context) {
+	var req healthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Ready != nil {
+		a.health.SetReady(*req.Ready)
+	}
+	if req.Live != nil {
+		a.health.SetLive(*req.Live)
+	}
+
+	c.JSON(http.StatusOK, a.state())
+}
+
+func (a *API) getGRPCHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, a.grpcHealth.ServingStatuses(c.Request.Context()))
+}
+
+func (a *API) setGRPCHealth(c *gin.Context) {
+	var req grpcHealthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.grpcHealth.SetServingStatus(req.Service, req.Status); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a.grpcHealth.ServingStatuses(c.Request.Context()))
+}
+
+func (a *API) setFault(c *gin.Context) {
+	var req faultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config := a.injector.Config()
+	if req.Enabled != nil {
+		config.Enabled = *req.Enabled
+	}
+	if req.Latency != nil {
+		latency, err := time.ParseDuration(*req.Latency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		config.Latency = latency
+	}
+	if req.ErrorRate != nil {
+		config.ErrorRate = *req.ErrorRate
+	}
+	if req.ErrorCode != nil {
+		config.ErrorCode = *req.ErrorCode
+	}
+
+	if err := a.injector.SetConfig(config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a.state())
+}
+
+func (a *API) disableFault(c *gin.Context) {
+	config := a.injector.Config()
+	config.Enabled = false
+
+	if err := a.injector.SetConfig(config); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, a.state())
+}
+
+func (a *API) setWorkload(c *gin.Context) {
+	var config workload.Config
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wl, err := workload.New(config, a.logger)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a.workload.Set(wl)
+
+	c.JSON(http.StatusOK, a.state())
+}
+
+func (a *API) state() gin.H {
+	faultConfig := a.injector.Config()
+
+	return gin.H{
+		"ready":   a.health.IsReady(),
+		"live":    a.health.IsLive(),
+		"started": a.health.IsStarted(),
+		"fault": gin.H{
+			"enabled":   faultConfig.Enabled,
+			"latency":   faultConfig.Latency.String(),
+			"errorRate": faultConfig.ErrorRate,
+			"errorCode": faultConfig.ErrorCode,
+		},
+		"workload": a.workload.GetName(),
+	}
+}
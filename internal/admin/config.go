@@ -0,0 +1,42 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+type Config struct {
+	// Enabled exposes the admin API on the health check server
+	Enabled bool `mapstructure:"enabled"`
+
+	// Endpoint is the path prefix of the admin API
+	Endpoint string `mapstructure:"endpoint"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.Endpoint == "" {
+		c.Endpoint = "/admin"
+	}
+
+	if !strings.HasPrefix(c.Endpoint, "/") {
+		return c, errors.New("admin endpoint must start with '/'")
+	}
+
+	return c, nil
+}
@@ -0,0 +1,57 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"net/http"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+type Config struct {
+	// Enabled turns fault injection on
+	Enabled bool `mapstructure:"enabled"`
+
+	// Latency is added to every incoming request
+	Latency time.Duration `mapstructure:"latency"`
+
+	// ErrorRate is the ratio of incoming requests that fail, between 0 and 1
+	ErrorRate float64 `mapstructure:"errorRate"`
+
+	// ErrorCode is the HTTP status code of the failed requests
+	ErrorCode int `mapstructure:"errorCode"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.Latency < 0 {
+		return c, errors.New("latency must not be negative")
+	}
+
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return c, errors.New("error rate must be between 0 and 1")
+	}
+
+	if c.ErrorCode == 0 {
+		c.ErrorCode = http.StatusServiceUnavailable
+	}
+
+	if c.ErrorCode < 100 || c.ErrorCode > 599 {
+		return c, errors.New("error code must be a valid HTTP status code")
+	}
+
+	return c, nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+// Error is returned for the requests that should fail
+type Error struct {
+	Code int
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("injected fault (code %d)", e.Code)
+}
+
+// Injector injects latency and errors into incoming requests, its
+// configuration can be changed at runtime
+type Injector struct {
+	mu     sync.RWMutex
+	config Config
+
+	logger log.Logger
+}
+
+func NewInjector(config Config, logger log.Logger) *Injector {
+	return &Injector{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Config returns the current configuration
+func (i *Injector) Config() Config {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.config
+}
+
+// SetConfig replaces the current configuration
+func (i *Injector) SetConfig(config Config) error {
+	config, err := config.Validate()
+	if err != nil {
+		return errors.WrapIf(err, "invalid fault config")
+	}
+
+	i.mu.Lock()
+	i.config = config
+	i.mu.Unlock()
+
+	i.logger.WithFields(log.Fields{
+		"enabled":   config.Enabled,
+		"latency":   config.Latency,
+		"errorRate": config.ErrorRate,
+		"errorCode": config.ErrorCode,
+	}).Info("fault injection changed")
+
+	return nil
+}
+
+// Inject delays the caller by the configured latency and returns an Error
+// for the configured ratio of calls
+func (i *Injector) Inject(ctx context.Context) error {
+	if i == nil {
+		return nil
+	}
+
+	config := i.Config()
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.Latency > 0 {
+		t := time.NewTimer(config.Latency)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if config.ErrorRate > 0 && rand.Float64() < config.ErrorRate { // nolint:gosec
+		return Error{Code: config.ErrorCode}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+)
+
+// MeshIstio generates VirtualServices and DestinationRules
+const MeshIstio = "istio"
+
+type Config struct {
+	// OutputDir is the directory the manifests are written to
+	OutputDir string `mapstructure:"outputDir"`
+	// Image is the allspark container image
+	Image string `mapstructure:"image"`
+	// Namespace is set on the resources when not empty
+	Namespace string `mapstructure:"namespace"`
+	// Mesh generates the traffic management resources of a service mesh
+	// Accepted values are: istio
+	Mesh string `mapstructure:"mesh"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.OutputDir == "" {
+		c.OutputDir = "manifests"
+	}
+
+	if c.Image == "" {
+		c.Image = "banzaicloud/allspark:latest"
+	}
+
+	if c.Mesh != "" && c.Mesh != MeshIstio {
+		return c, emperror.With(errors.New("invalid mesh"), "mesh", c.Mesh)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,269 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/banzaicloud/allspark/internal/topology"
+)
+
+const (
+	healthcheckPort   = 8081
+	subsetName        = "v1"
+	containerName     = "allspark"
+	configMapSuffix   = "-allspark"
+	livenessEndpoint  = "/livez"
+	readinessEndpoint = "/readyz"
+)
+
+// EnvFunc returns the environment variables configuring a service
+type EnvFunc func(t topology.Topology, service topology.Service) (map[string]string, error)
+
+// Manifests creates the Kubernetes manifests of every service of the topology,
+// the returned map holds the contents by file name
+func Manifests(config Config, t topology.Topology, env EnvFunc) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	for _, name := range t.ServiceNames() {
+		service := t.Services[name]
+
+		vars, err := env(t, service)
+		if err != nil {
+			return nil, emperror.With(err, "service", name)
+		}
+
+		resources := []yaml.MapSlice{
+			configMap(config, name, vars),
+			deployment(config, name, service),
+			kubernetesService(config, name, service),
+		}
+		if config.Mesh == MeshIstio {
+			resources = append(resources, virtualService(config, name, service), destinationRule(config, name))
+		}
+
+		var buf bytes.Buffer
+		for i, resource := range resources {
+			if i > 0 {
+				buf.WriteString("---\n")
+			}
+			out, err := yaml.Marshal(resource)
+			if err != nil {
+				return nil, errors.WrapIf(err, "could not marshal manifest")
+			}
+			buf.Write(out)
+		}
+		files[name+".yaml"] = buf.Bytes()
+	}
+
+	return files, nil
+}
+
+// Write writes the files to the directory, creating it if necessary
+func Write(dir string, files map[string][]byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.WrapIf(err, "could not create output directory")
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil { // nolint:gosec
+			return emperror.With(errors.WrapIf(err, "could not write manifest"), "file", name)
+		}
+	}
+
+	return nil
+}
+
+func metadata(config Config, name string) yaml.MapSlice {
+	m := yaml.MapSlice{{Key: "name", Value: name}}
+	if config.Namespace != "" {
+		m = append(m, yaml.MapItem{Key: "namespace", Value: config.Namespace})
+	}
+
+	return m
+}
+
+func labels(name string) yaml.MapSlice {
+	return yaml.MapSlice{
+		{Key: "app", Value: name},
+		{Key: "version", Value: subsetName},
+	}
+}
+
+func configMap(config Config, name string, vars map[string]string) yaml.MapSlice {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data := yaml.MapSlice{}
+	for _, key := range keys {
+		data = append(data, yaml.MapItem{Key: key, Value: vars[key]})
+	}
+
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "ConfigMap"},
+		{Key: "metadata", Value: append(metadata(config, name+configMapSuffix), yaml.MapItem{Key: "labels", Value: yaml.MapSlice{{Key: "app", Value: name}}})},
+		{Key: "data", Value: data},
+	}
+}
+
+func deployment(config Config, name string, service topology.Service) yaml.MapSlice {
+	ports := []yaml.MapSlice{}
+	for _, protocol := range protocols(service) {
+		ports = append(ports, yaml.MapSlice{
+			{Key: "name", Value: protocol},
+			{Key: "containerPort", Value: service.Port(protocol)},
+			{Key: "protocol", Value: transportProtocol(protocol)},
+		})
+	}
+
+	probe := func(path string) yaml.MapSlice {
+		return yaml.MapSlice{
+			{Key: "httpGet", Value: yaml.MapSlice{
+				{Key: "path", Value: path},
+				{Key: "port", Value: healthcheckPort},
+			}},
+		}
+	}
+
+	container := yaml.MapSlice{
+		{Key: "name", Value: containerName},
+		{Key: "image", Value: config.Image},
+		{Key: "ports", Value: ports},
+		{Key: "env", Value: []yaml.MapSlice{
+			{
+				{Key: "name", Value: "SERVICE_NAME"},
+				{Key: "value", Value: name},
+			},
+		}},
+		{Key: "envFrom", Value: []yaml.MapSlice{
+			{{Key: "configMapRef", Value: yaml.MapSlice{{Key: "name", Value: name + configMapSuffix}}}},
+		}},
+		{Key: "readinessProbe", Value: probe(readinessEndpoint)},
+		{Key: "livenessProbe", Value: probe(livenessEndpoint)},
+	}
+
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "apps/v1"},
+		{Key: "kind", Value: "Deployment"},
+		{Key: "metadata", Value: append(metadata(config, name), yaml.MapItem{Key: "labels", Value: labels(name)})},
+		{Key: "spec", Value: yaml.MapSlice{
+			{Key: "replicas", Value: 1},
+			{Key: "selector", Value: yaml.MapSlice{{Key: "matchLabels", Value: labels(name)}}},
+			{Key: "template", Value: yaml.MapSlice{
+				{Key: "metadata", Value: yaml.MapSlice{{Key: "labels", Value: labels(name)}}},
+				{Key: "spec", Value: yaml.MapSlice{
+					{Key: "containers", Value: []yaml.MapSlice{container}},
+				}},
+			}},
+		}},
+	}
+}
+
+func kubernetesService(config Config, name string, service topology.Service) yaml.MapSlice {
+	ports := []yaml.MapSlice{}
+	for _, protocol := range protocols(service) {
+		ports = append(ports, yaml.MapSlice{
+			// the port name prefix tells the protocol to service meshes
+			{Key: "name", Value: protocol},
+			{Key: "port", Value: service.Port(protocol)},
+			{Key: "targetPort", Value: service.Port(protocol)},
+			{Key: "protocol", Value: transportProtocol(protocol)},
+		})
+	}
+
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "Service"},
+		{Key: "metadata", Value: append(metadata(config, name), yaml.MapItem{Key: "labels", Value: yaml.MapSlice{{Key: "app", Value: name}}})},
+		{Key: "spec", Value: yaml.MapSlice{
+			{Key: "selector", Value: yaml.MapSlice{{Key: "app", Value: name}}},
+			{Key: "ports", Value: ports},
+		}},
+	}
+}
+
+func virtualService(config Config, name string, service topology.Service) yaml.MapSlice {
+	route := []yaml.MapSlice{
+		{{Key: "route", Value: []yaml.MapSlice{
+			{{Key: "destination", Value: yaml.MapSlice{
+				{Key: "host", Value: name},
+				{Key: "subset", Value: subsetName},
+			}}},
+		}}},
+	}
+
+	spec := yaml.MapSlice{{Key: "hosts", Value: []string{name}}}
+	if service.Serves(topology.ProtocolHTTP) || service.Serves(topology.ProtocolGRPC) {
+		spec = append(spec, yaml.MapItem{Key: "http", Value: route})
+	}
+	if service.Serves(topology.ProtocolTCP) {
+		spec = append(spec, yaml.MapItem{Key: "tcp", Value: route})
+	}
+
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "networking.istio.io/v1beta1"},
+		{Key: "kind", Value: "VirtualService"},
+		{Key: "metadata", Value: metadata(config, name)},
+		{Key: "spec", Value: spec},
+	}
+}
+
+func destinationRule(config Config, name string) yaml.MapSlice {
+	return yaml.MapSlice{
+		{Key: "apiVersion", Value: "networking.istio.io/v1beta1"},
+		{Key: "kind", Value: "DestinationRule"},
+		{Key: "metadata", Value: metadata(config, name)},
+		{Key: "spec", Value: yaml.MapSlice{
+			{Key: "host", Value: name},
+			{Key: "subsets", Value: []yaml.MapSlice{
+				{
+					{Key: "name", Value: subsetName},
+					{Key: "labels", Value: yaml.MapSlice{{Key: "version", Value: subsetName}}},
+				},
+			}},
+		}},
+	}
+}
+
+// protocols returns the served protocols in a stable order
+func protocols(service topology.Service) []string {
+	var protocols []string
+	for _, protocol := range []string{topology.ProtocolHTTP, topology.ProtocolGRPC, topology.ProtocolTCP, topology.ProtocolUDP} {
+		if service.Serves(protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	return protocols
+}
+
+func transportProtocol(protocol string) string {
+	if protocol == topology.ProtocolUDP {
+		return "UDP"
+	}
+
+	return "TCP"
+}
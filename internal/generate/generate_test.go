@@ -0,0 +1,95 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generate
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/banzaicloud/allspark/internal/topology"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// testEnv sets the requests of the service like the topology mode of the command
+func testEnv(t topology.Topology, service topology.Service) (map[string]string, error) {
+	requests, err := t.Requests(service)
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{"REQUESTS": strings.Join(requests, " ")}
+	if service.Workload.Name != "" {
+		env["WORKLOAD"] = service.Workload.Name
+	}
+
+	return env, nil
+}
+
+func TestManifests(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name:   "plain",
+			config: Config{Image: "banzaicloud/allspark:test"},
+		},
+		{
+			name:   "istio",
+			config: Config{Image: "banzaicloud/allspark:test", Namespace: "allspark", Mesh: MeshIstio},
+		},
+	}
+
+	topo, err := topology.Load(filepath.Join("testdata", "topology.yaml"))
+	if err != nil {
+		t.Fatalf("could not load topology: %v", err)
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			files, err := Manifests(test.config, topo, testEnv)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(files) != len(topo.Services) {
+				t.Errorf("got %d files, want one per service (%d)", len(files), len(topo.Services))
+			}
+
+			for name, content := range files {
+				golden := filepath.Join("testdata", test.name, name)
+				if *update {
+					if err := Write(filepath.Dir(golden), map[string][]byte{name: content}); err != nil {
+						t.Fatalf("could not update golden file: %v", err)
+					}
+					continue
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("could not read golden file: %v", err)
+				}
+				if string(content) != string(want) {
+					t.Errorf("%s does not match the golden file %s, run the tests with -update to regenerate it\ngot:\n%s", name, golden, content)
+				}
+			}
+		})
+	}
+}
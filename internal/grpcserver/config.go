@@ -14,8 +14,52 @@
 
 package grpcserver
 
+import (
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+)
+
 type Config struct {
 	ListenAddress string `mapstructure:"listenAddress"`
+
+	// ConnectionTimeout is the deadline for establishing new connections
+	ConnectionTimeout time.Duration `mapstructure:"connectionTimeout"`
+
+	// MaxConcurrentStreams limits the number of concurrent streams per connection
+	MaxConcurrentStreams uint32 `mapstructure:"maxConcurrentStreams"`
+
+	// MaxRecvMsgSize and MaxSendMsgSize limit the message sizes in bytes, GRPC defaults are used if not set
+	MaxRecvMsgSize int `mapstructure:"maxRecvMsgSize"`
+	MaxSendMsgSize int `mapstructure:"maxSendMsgSize"`
+
+	Keepalive            KeepaliveConfig            `mapstructure:"keepalive"`
+	KeepaliveEnforcement KeepaliveEnforcementConfig `mapstructure:"keepaliveEnforcement"`
+
+	// Interceptors are the names of the built-in interceptors to enable, in order
+	// Accepted values are: logging, recovery
+	Interceptors []string `mapstructure:"interceptors"`
+
+	// Limits are the rate and concurrency limits of the incoming requests
+	Limits limiter.Config `mapstructure:"limits"`
+}
+
+// KeepaliveConfig holds the server keepalive parameters
+type KeepaliveConfig struct {
+	MaxConnectionIdle     time.Duration `mapstructure:"maxConnectionIdle"`
+	MaxConnectionAge      time.Duration `mapstructure:"maxConnectionAge"`
+	MaxConnectionAgeGrace time.Duration `mapstructure:"maxConnectionAgeGrace"`
+	Time                  time.Duration `mapstructure:"time"`
+	Timeout               time.Duration `mapstructure:"timeout"`
+}
+
+// KeepaliveEnforcementConfig holds the keepalive enforcement policy
+type KeepaliveEnforcementConfig struct {
+	MinTime             time.Duration `mapstructure:"minTime"`
+	PermitWithoutStream *bool         `mapstructure:"permitWithoutStream"`
 }
 
 // Validate checks that the configuration is valid.
@@ -24,5 +68,60 @@ func (c Config) Validate() (Config, error) {
 		c.ListenAddress = "0.0.0.0:8082"
 	}
 
+	if c.ConnectionTimeout == 0 {
+		c.ConnectionTimeout = time.Second
+	}
+
+	if c.MaxConcurrentStreams == 0 {
+		c.MaxConcurrentStreams = 5
+	}
+
+	if c.MaxRecvMsgSize < 0 || c.MaxSendMsgSize < 0 {
+		return c, errors.New("max message sizes must not be negative")
+	}
+
+	if c.Keepalive.MaxConnectionIdle == 0 {
+		c.Keepalive.MaxConnectionIdle = 10 * time.Second
+	}
+
+	if c.Keepalive.Timeout == 0 {
+		c.Keepalive.Timeout = 20 * time.Second
+	}
+
+	if c.KeepaliveEnforcement.MinTime == 0 {
+		c.KeepaliveEnforcement.MinTime = time.Second
+	}
+
+	if c.KeepaliveEnforcement.PermitWithoutStream == nil {
+		permitWithoutStream := true
+		c.KeepaliveEnforcement.PermitWithoutStream = &permitWithoutStream
+	}
+
+	for name, d := range map[string]time.Duration{
+		"connection timeout":                 c.ConnectionTimeout,
+		"keepalive max connection idle":      c.Keepalive.MaxConnectionIdle,
+		"keepalive max connection age":       c.Keepalive.MaxConnectionAge,
+		"keepalive max connection age grace": c.Keepalive.MaxConnectionAgeGrace,
+		"keepalive time":                     c.Keepalive.Time,
+		"keepalive timeout":                  c.Keepalive.Timeout,
+		"keepalive enforcement min time":     c.KeepaliveEnforcement.MinTime,
+	} {
+		if d < 0 {
+			return c, errors.Errorf("%s must not be negative", name)
+		}
+	}
+
+	for _, name := range c.Interceptors {
+		if _, ok := interceptors[name]; !ok {
+			return c, emperror.With(errors.New("invalid interceptor"), "interceptor", name)
+		}
+	}
+
+	limits, err := c.Limits.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "invalid limits")
+	}
+	c.Limits = limits
+
 	return c, nil
 }
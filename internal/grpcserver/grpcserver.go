@@ -19,15 +19,19 @@ import (
 	"net"
 	"net/http"
 	"sync"
-	"time"
 
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/limiter"
 	"github.com/banzaicloud/allspark/internal/pb"
 	"github.com/banzaicloud/allspark/internal/platform/log"
 	"github.com/banzaicloud/allspark/internal/request"
@@ -35,28 +39,59 @@ import (
 	"github.com/banzaicloud/allspark/internal/workload"
 )
 
+// defaultMaxResponseSize is the response payload size limit without MaxSendMsgSize,
+// it matches the default receive limit of GRPC clients
+const defaultMaxResponseSize = 4 * 1024 * 1024
+
 type Server struct {
+	pb.UnimplementedAllsparkServer
+
 	requests request.Requests
 	workload workload.Workload
 
 	sqlCient *sql.Client
 
+	faultInjector *fault.Injector
+
 	listenAddress string
 
+	// maxResponseSize limits the response payload size the clients can ask for
+	maxResponseSize int
+
+	server *grpc.Server
+	health *healthServer
+
 	errorHandler emperror.Handler
 	logger       log.Logger
 }
 
 func New(config Config, logger log.Logger, errorHandler emperror.Handler) *Server {
 	logger = logger.WithField("server", "grpc")
-	return &Server{
+	s := &Server{
 		requests: make(request.Requests, 0),
 
-		listenAddress: config.ListenAddress,
+		listenAddress:   config.ListenAddress,
+		maxResponseSize: config.MaxSendMsgSize,
 
 		errorHandler: errorHandler,
 		logger:       logger,
 	}
+
+	if s.maxResponseSize == 0 {
+		s.maxResponseSize = defaultMaxResponseSize
+	}
+
+	s.server = grpc.NewServer(serverOptions(config, logger)...)
+	pb.RegisterAllsparkServer(s.server, s)
+
+	// Register the standard health checking service.
+	s.health = newHealthServer(s.server)
+	healthpb.RegisterHealthServer(s.server, s.health)
+
+	// Register reflection service on gRPC server.
+	reflection.Register(s.server)
+
+	return s
 }
 
 func (s *Server) SetWorkload(workload workload.Workload) {
@@ -72,6 +107,10 @@ func (s *Server) SetSQLClient(client *sql.Client) {
 	s.sqlCient = client
 }
 
+func (s *Server) SetFaultInjector(injector *fault.Injector) {
+	s.faultInjector = injector
+}
+
 func (s *Server) Run() {
 	lis, err := net.Listen("tcp", s.listenAddress)
 	if err != nil {
@@ -80,31 +119,61 @@ func (s *Server) Run() {
 	}
 	s.logger.WithField("address", s.listenAddress).Info("starting GRPC server")
 
-	gs := grpc.NewServer(
-		grpc.ConnectionTimeout(time.Second),
-		grpc.KeepaliveParams(keepalive.ServerParameters{
-			MaxConnectionIdle: time.Second * 10,
-			Timeout:           time.Second * 20,
-		}),
-		grpc.KeepaliveEnforcementPolicy(
-			keepalive.EnforcementPolicy{
-				MinTime:             time.Second,
-				PermitWithoutStream: true,
-			}),
-		grpc.MaxConcurrentStreams(5),
-	)
-	pb.RegisterAllsparkServer(gs, s)
-
-	// Register reflection service on gRPC server.
-	reflection.Register(gs)
-	if err := gs.Serve(lis); err != nil {
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 		s.errorHandler.Handle(errors.WrapIf(err, "could not serve"))
 	}
 }
 
-func (s *Server) Incoming(ctx context.Context, x *pb.Params) (*pb.Msg, error) {
+// Shutdown stops the server gracefully and falls back to a hard stop when the
+// in-flight RPCs are not finished before the context expires
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down GRPC server")
+
+	// the Watch streams of the health service would block the graceful stop
+	s.health.shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return errors.WrapIf(ctx.Err(), "could not gracefully stop GRPC server")
+	}
+}
+
+func (s *Server) Incoming(ctx context.Context, params *pb.Params) (*pb.Msg, error) {
 	s.logger.Info("incoming request")
 
+	payload, err := s.responsePayload(params)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.handle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Msg{
+		Response: response,
+		Payload:  payload,
+	}, nil
+}
+
+// handle does everything an incoming request triggers: fault injection,
+// subsequent requests, SQL query and the workload
+func (s *Server) handle(ctx context.Context) (string, error) {
+	if err := s.faultInjector.Inject(ctx); err != nil {
+		s.logger.WithField("error", err.Error()).Warn("fault injected")
+		return "", status.Error(faultCode(err), err.Error())
+	}
+
 	headers := make(http.Header)
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
 		for h, vs := range md {
@@ -114,7 +183,12 @@ func (s *Server) Incoming(ctx context.Context, x *pb.Params) (*pb.Msg, error) {
 		}
 	}
 
-	s.doRequests(headers)
+	// the full method name is the path of the incoming request, e.g. /allspark/Incoming
+	method, _ := grpc.Method(ctx)
+	s.doRequests(request.Incoming{
+		Headers: headers,
+		Path:    method,
+	})
 
 	if s.sqlCient != nil {
 		go func() {
@@ -128,32 +202,112 @@ func (s *Server) Incoming(ctx context.Context, x *pb.Params) (*pb.Msg, error) {
 	}
 
 	if s.workload == nil {
-		return &pb.Msg{}, nil
+		return "", nil
 	}
 
 	response, _, err := s.workload.Execute()
+	if errors.Is(err, workload.ErrNoWorkload) {
+		return "", nil
+	}
 	if err != nil {
-		return &pb.Msg{}, errors.WrapIf(err, "could not run workload")
+		return "", errors.WrapIf(err, "could not run workload")
 	}
 
-	return &pb.Msg{
-		Response: response,
-	}, nil
+	return response, nil
 }
 
-func (s *Server) doRequests(incomingRequestHeaders http.Header) {
+// faultCode returns the GRPC status code matching the HTTP status code of the injected fault
+func faultCode(err error) codes.Code {
+	var faultErr fault.Error
+	if !errors.As(err, &faultErr) {
+		return codes.Unavailable
+	}
+
+	switch faultErr.Code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	if faultErr.Code >= http.StatusInternalServerError {
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
+
+func (s *Server) doRequests(incoming request.Incoming) {
 	var wg sync.WaitGroup
 
-	for _, r := range s.requests {
+	for _, r := range s.requests.Select(incoming) {
 		var i uint
 		for i = 0; i < r.Count(); i++ {
 			wg.Add(1)
 			go func(request request.Request) {
 				defer wg.Done()
-				request.Do(incomingRequestHeaders, s.logger)
+				request.Do(incoming.Headers, s.logger)
 			}(r)
 		}
 	}
 
 	wg.Wait()
 }
+
+// serverOptions creates the GRPC server options from the configuration
+func serverOptions(config Config, logger log.Logger) []grpc.ServerOption {
+	options := []grpc.ServerOption{
+		grpc.ConnectionTimeout(config.ConnectionTimeout),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     config.Keepalive.MaxConnectionIdle,
+			MaxConnectionAge:      config.Keepalive.MaxConnectionAge,
+			MaxConnectionAgeGrace: config.Keepalive.MaxConnectionAgeGrace,
+			Time:                  config.Keepalive.Time,
+			Timeout:               config.Keepalive.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(
+			keepalive.EnforcementPolicy{
+				MinTime:             config.KeepaliveEnforcement.MinTime,
+				PermitWithoutStream: config.KeepaliveEnforcement.PermitWithoutStream != nil && *config.KeepaliveEnforcement.PermitWithoutStream,
+			}),
+		grpc.MaxConcurrentStreams(config.MaxConcurrentStreams),
+	}
+
+	if config.MaxRecvMsgSize > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(config.MaxRecvMsgSize))
+	}
+	if config.MaxSendMsgSize > 0 {
+		options = append(options, grpc.MaxSendMsgSize(config.MaxSendMsgSize))
+	}
+
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	if l := limiter.New(config.Limits); l != nil {
+		unary = append(unary, limitUnaryInterceptor(l, logger))
+		stream = append(stream, limitStreamInterceptor(l, logger))
+	}
+	for _, name := range config.Interceptors {
+		i := interceptors[name]
+		unary = append(unary, i.unary(logger))
+		stream = append(stream, i.stream(logger))
+	}
+	options = append(options, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+
+	return options
+}
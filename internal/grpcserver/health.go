@@ -0,0 +1,240 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const (
+	healthWatchInterval = time.Second
+	// readinessCacheTTL is how long the result of the readiness check is reused,
+	// so the dependencies are not probed on every health check
+	readinessCacheTTL = time.Second
+)
+
+// ReadinessCheck reports an error when the service is not ready to serve
+type ReadinessCheck func(ctx context.Context) error
+
+// healthServer implements the standard GRPC health checking protocol, the
+// status of the registered services follows readiness unless it is overridden
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	server *grpc.Server
+
+	mu        sync.RWMutex
+	readiness ReadinessCheck
+	overrides map[string]healthpb.HealthCheckResponse_ServingStatus
+
+	// readyMu serializes the readiness checks and guards their cached result
+	readyMu   sync.Mutex
+	ready     bool
+	checkedAt time.Time
+
+	// stopping is closed on shutdown to end the Watch streams
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+}
+
+func newHealthServer(server *grpc.Server) *healthServer {
+	return &healthServer{
+		server:    server,
+		overrides: make(map[string]healthpb.HealthCheckResponse_ServingStatus),
+		stopping:  make(chan struct{}),
+	}
+}
+
+// shutdown reports every service as not serving and ends the Watch streams,
+// so they do not block the graceful stop of the server
+func (h *healthServer) shutdown() {
+	h.stoppingOnce.Do(func() {
+		close(h.stopping)
+	})
+}
+
+func (h *healthServer) isStopping() bool {
+	select {
+	case <-h.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// isReady runs the readiness check, or returns its cached result if it is recent enough
+func (h *healthServer) isReady(ctx context.Context, readiness ReadinessCheck) bool {
+	h.readyMu.Lock()
+	defer h.readyMu.Unlock()
+
+	if !h.checkedAt.IsZero() && time.Since(h.checkedAt) < readinessCacheTTL {
+		return h.ready
+	}
+
+	ready := readiness(ctx) == nil
+	// the result of a canceled check is not cached as it says nothing about the dependencies
+	if ctx.Err() == nil {
+		h.ready = ready
+		h.checkedAt = time.Now()
+	}
+
+	return ready
+}
+
+func (h *healthServer) setReadinessCheck(check ReadinessCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.readiness = check
+}
+
+func (h *healthServer) setOverride(service string, servingStatus healthpb.HealthCheckResponse_ServingStatus, override bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if override {
+		h.overrides[service] = servingStatus
+	} else {
+		delete(h.overrides, service)
+	}
+}
+
+func (h *healthServer) statuses(ctx context.Context) map[string]string {
+	statuses := make(map[string]string)
+
+	statuses[""] = h.status(ctx, "").String()
+	for service := range h.server.GetServiceInfo() {
+		statuses[service] = h.status(ctx, service).String()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for service, servingStatus := range h.overrides {
+		statuses[service] = servingStatus.String()
+	}
+
+	return statuses
+}
+
+func (h *healthServer) status(ctx context.Context, service string) healthpb.HealthCheckResponse_ServingStatus {
+	h.mu.RLock()
+	servingStatus, overridden := h.overrides[service]
+	readiness := h.readiness
+	h.mu.RUnlock()
+
+	if h.isStopping() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	if overridden {
+		return servingStatus
+	}
+
+	if _, ok := h.server.GetServiceInfo()[service]; service != "" && !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+
+	if readiness != nil && !h.isReady(ctx, readiness) {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus := h.status(ctx, req.GetService())
+	if servingStatus == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+
+	return &healthpb.HealthCheckResponse{
+		Status: servingStatus,
+	}, nil
+}
+
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		servingStatus := h.status(stream.Context(), req.GetService())
+		if servingStatus != last {
+			err := stream.Send(&healthpb.HealthCheckResponse{
+				Status: servingStatus,
+			})
+			if err != nil {
+				return errors.WrapIf(err, "could not send health status")
+			}
+			last = servingStatus
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		case <-h.stopping:
+			if last == healthpb.HealthCheckResponse_NOT_SERVING {
+				return nil
+			}
+			err := stream.Send(&healthpb.HealthCheckResponse{
+				Status: healthpb.HealthCheckResponse_NOT_SERVING,
+			})
+			return errors.WrapIf(err, "could not send health status")
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetReadinessCheck ties the serving status of the GRPC health service to the given check
+func (s *Server) SetReadinessCheck(check ReadinessCheck) {
+	s.health.setReadinessCheck(check)
+}
+
+// SetServingStatus overrides the serving status of a service reported by the
+// GRPC health service, an empty status restores following readiness
+func (s *Server) SetServingStatus(service string, servingStatus string) error {
+	if servingStatus == "" {
+		s.health.setOverride(service, 0, false)
+		s.logger.WithField("service", service).Info("GRPC serving status override removed")
+		return nil
+	}
+
+	value, ok := healthpb.HealthCheckResponse_ServingStatus_value[servingStatus]
+	if !ok {
+		return errors.Errorf("invalid serving status: '%s'", servingStatus)
+	}
+	s.health.setOverride(service, healthpb.HealthCheckResponse_ServingStatus(value), true)
+	s.logger.WithFields(log.Fields{
+		"service": service,
+		"status":  servingStatus,
+	}).Info("GRPC serving status overridden")
+
+	return nil
+}
+
+// ServingStatuses returns the serving status of every known service
+func (s *Server) ServingStatuses(ctx context.Context) map[string]string {
+	return s.health.statuses(ctx)
+}
@@ -0,0 +1,158 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+type interceptor struct {
+	unary  func(logger log.Logger) grpc.UnaryServerInterceptor
+	stream func(logger log.Logger) grpc.StreamServerInterceptor
+}
+
+// nolint: gochecknoglobals
+var interceptors = map[string]interceptor{
+	"logging": {
+		unary:  loggingUnaryInterceptor,
+		stream: loggingStreamInterceptor,
+	},
+	"recovery": {
+		unary:  recoveryUnaryInterceptor,
+		stream: recoveryStreamInterceptor,
+	},
+}
+
+func loggingUnaryInterceptor(logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(logger, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+func loggingStreamInterceptor(logger log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(logger, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+func logCall(logger log.Logger, method string, start time.Time, err error) {
+	logger.WithFields(log.Fields{
+		"method":   method,
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start),
+	}).Info("GRPC call finished")
+}
+
+func recoveryUnaryInterceptor(logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func recoveryStreamInterceptor(logger log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(logger, info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+func recovered(logger log.Logger, method string, r interface{}) error {
+	logger.WithFields(log.Fields{
+		"method": method,
+		"panic":  r,
+	}).Error("recovered from panic")
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// limitUnaryInterceptor rejects the calls with RESOURCE_EXHAUSTED when the
+// rate or concurrency limit is exceeded, health checks are never limited
+func limitUnaryInterceptor(l *limiter.Limiter, logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isHealthCheck(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		release, err := acquire(l, logger, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		return handler(ctx, req)
+	}
+}
+
+func limitStreamInterceptor(l *limiter.Limiter, logger log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isHealthCheck(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		release, err := acquire(l, logger, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return handler(srv, ss)
+	}
+}
+
+func acquire(l *limiter.Limiter, logger log.Logger, method string) (func(), error) {
+	release, err := l.Acquire()
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"method": method,
+			"error":  err.Error(),
+		}).Debug("call rejected")
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	return release, nil
+}
+
+func isHealthCheck(method string) bool {
+	return strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,174 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcserver
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"emperror.dev/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/banzaicloud/allspark/internal/pb"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+func (s *Server) ServerStream(params *pb.Params, stream pb.Allspark_ServerStreamServer) error {
+	count := params.GetHints().GetMessageCount()
+	if count == 0 {
+		count = 1
+	}
+	interval := time.Duration(params.GetHints().GetMessageIntervalMs()) * time.Millisecond
+
+	logger := s.logger.WithFields(log.Fields{
+		"messageCount":    count,
+		"messageInterval": interval,
+	})
+	logger.Info("incoming server stream")
+
+	payload, err := s.responsePayload(params)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.handle(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(1); i <= count; i++ {
+		if i > 1 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+
+		err := stream.Send(&pb.Msg{
+			Response: response,
+			Payload:  payload,
+			Sequence: i,
+		})
+		if err != nil {
+			return errors.WrapIf(err, "could not send message")
+		}
+	}
+
+	logger.Info("server stream finished")
+
+	return nil
+}
+
+func (s *Server) ClientStream(stream pb.Allspark_ClientStreamServer) error {
+	s.logger.Info("incoming client stream")
+
+	var count uint32
+	var size int
+	var last *pb.Params
+	for {
+		params, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errors.WrapIf(err, "could not receive message")
+		}
+		count++
+		size += len(params.GetPayload())
+		last = params
+	}
+
+	s.logger.WithFields(log.Fields{
+		"messages": count,
+		"bytes":    size,
+	}).Info("client stream finished")
+
+	payload, err := s.responsePayload(last)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.handle(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(&pb.Msg{
+		Response: response,
+		Payload:  payload,
+		Sequence: count,
+	})
+}
+
+func (s *Server) BidiStream(stream pb.Allspark_BidiStreamServer) error {
+	s.logger.Info("incoming bidirectional stream")
+
+	response, err := s.handle(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	var count uint32
+	for {
+		params, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errors.WrapIf(err, "could not receive message")
+		}
+		count++
+
+		payload, err := s.responsePayload(params)
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&pb.Msg{
+			Response: response,
+			Payload:  payload,
+			Sequence: count,
+		})
+		if err != nil {
+			return errors.WrapIf(err, "could not send message")
+		}
+	}
+
+	s.logger.WithField("messages", count).Info("bidirectional stream finished")
+
+	return nil
+}
+
+// responsePayload returns the payload the params ask for in the response,
+// sizes above the response size limit of the server are rejected
+func (s *Server) responsePayload(params *pb.Params) ([]byte, error) {
+	hints := params.GetHints()
+	if hints.GetEcho() {
+		return params.GetPayload(), nil
+	}
+
+	size := hints.GetResponseSize()
+	if size == 0 {
+		return nil, nil
+	}
+	if uint64(size) > uint64(s.maxResponseSize) {
+		return nil, status.Errorf(codes.InvalidArgument, "response size %d exceeds the limit of %d bytes", size, s.maxResponseSize)
+	}
+
+	return bytes.Repeat([]byte("."), int(size)), nil
+}
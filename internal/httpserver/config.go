@@ -14,9 +14,75 @@
 
 package httpserver
 
+import (
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+)
+
+const (
+	// WebSocketModeEcho sends every received message back
+	WebSocketModeEcho = "echo"
+	// WebSocketModeStream sends the output of the workload periodically
+	WebSocketModeStream = "stream"
+
+	// StreamFormatChunked streams the events as plain chunks of a chunked response
+	StreamFormatChunked = "chunked"
+	// StreamFormatSSE streams the events as Server-Sent Events
+	StreamFormatSSE = "sse"
+)
+
 type Config struct {
 	ListenAddress string `mapstructure:"listenAddress"`
 	Endpoint      string `mapstructure:"endpoint"`
+
+	// H2C enables HTTP/2 over cleartext, both with prior knowledge and through HTTP/1.1 upgrade
+	H2C bool `mapstructure:"h2c"`
+
+	WebSocket WebSocketConfig `mapstructure:"websocket"`
+
+	Stream StreamConfig `mapstructure:"stream"`
+
+	// Limits are the rate and concurrency limits of the incoming requests
+	Limits limiter.Config `mapstructure:"limits"`
+}
+
+// WebSocketConfig holds the options of the WebSocket endpoint
+type WebSocketConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Mode is how the server handles the connections
+	// Accepted values are: echo, stream
+	Mode string `mapstructure:"mode"`
+
+	// Interval is the delay between the streamed messages
+	Interval time.Duration `mapstructure:"interval"`
+	// Messages is the number of streamed messages before the connection is closed, unlimited if not set
+	Messages uint `mapstructure:"messages"`
+}
+
+// StreamConfig holds the defaults of the streaming endpoint, which can be
+// overridden by the query parameters of the requests
+type StreamConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Format is the format of the streamed response
+	// Accepted values are: chunked, sse
+	Format string `mapstructure:"format"`
+
+	// Events is the number of streamed events
+	Events uint `mapstructure:"events"`
+	// Size is the size of the payload of every event in bytes
+	Size uint `mapstructure:"size"`
+	// Interval is the delay between the events
+	Interval time.Duration `mapstructure:"interval"`
+
+	// MaxEvents and MaxSize limit the events and the size the requests can ask for
+	MaxEvents uint `mapstructure:"maxEvents"`
+	MaxSize   uint `mapstructure:"maxSize"`
 }
 
 // Validate checks that the configuration is valid.
@@ -29,5 +95,85 @@ func (c Config) Validate() (Config, error) {
 		c.Endpoint = "/"
 	}
 
+	if c.WebSocket.Endpoint == "" {
+		c.WebSocket.Endpoint = "/ws"
+	}
+
+	if c.WebSocket.Endpoint == c.Endpoint {
+		return c, emperror.With(errors.New("WebSocket endpoint must differ from the HTTP endpoint"), "endpoint", c.Endpoint)
+	}
+
+	if c.WebSocket.Mode == "" {
+		c.WebSocket.Mode = WebSocketModeEcho
+	}
+
+	switch c.WebSocket.Mode {
+	case WebSocketModeEcho, WebSocketModeStream:
+	default:
+		return c, emperror.With(errors.New("invalid WebSocket mode"), "mode", c.WebSocket.Mode)
+	}
+
+	if c.WebSocket.Interval == 0 {
+		c.WebSocket.Interval = time.Second
+	}
+
+	if c.Stream.Endpoint == "" {
+		c.Stream.Endpoint = "/stream"
+	}
+
+	if c.Stream.Endpoint == c.Endpoint || c.Stream.Endpoint == c.WebSocket.Endpoint {
+		return c, emperror.With(errors.New("stream endpoint must differ from the HTTP and WebSocket endpoints"), "endpoint", c.Stream.Endpoint)
+	}
+
+	if c.Stream.Format == "" {
+		c.Stream.Format = StreamFormatChunked
+	}
+
+	if !validStreamFormat(c.Stream.Format) {
+		return c, emperror.With(errors.New("invalid stream format"), "format", c.Stream.Format)
+	}
+
+	if c.Stream.Events == 0 {
+		c.Stream.Events = 10
+	}
+
+	if c.Stream.Size == 0 {
+		c.Stream.Size = 64
+	}
+
+	if c.Stream.Interval == 0 {
+		c.Stream.Interval = time.Second
+	}
+
+	if c.Stream.Interval < 0 {
+		return c, emperror.With(errors.New("stream interval must be positive"), "interval", c.Stream.Interval)
+	}
+
+	if c.Stream.MaxEvents == 0 {
+		c.Stream.MaxEvents = 10000
+	}
+
+	if c.Stream.MaxSize == 0 {
+		c.Stream.MaxSize = 1024 * 1024
+	}
+
+	if c.Stream.Events > c.Stream.MaxEvents {
+		return c, emperror.With(errors.New("stream events exceed the maximum"), "events", c.Stream.Events, "maxEvents", c.Stream.MaxEvents)
+	}
+
+	if c.Stream.Size > c.Stream.MaxSize {
+		return c, emperror.With(errors.New("stream size exceeds the maximum"), "size", c.Stream.Size, "maxSize", c.Stream.MaxSize)
+	}
+
+	limits, err := c.Limits.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "invalid limits")
+	}
+	c.Limits = limits
+
 	return c, nil
 }
+
+func validStreamFormat(format string) bool {
+	return format == StreamFormatChunked || format == StreamFormatSSE
+}
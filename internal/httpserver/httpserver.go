@@ -15,13 +15,19 @@
 package httpserver
 
 import (
+	"context"
 	"net/http"
 	"sync"
 
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/limiter"
 	"github.com/banzaicloud/allspark/internal/platform/log"
 	"github.com/banzaicloud/allspark/internal/request"
 	"github.com/banzaicloud/allspark/internal/sql"
@@ -34,8 +40,23 @@ type Server struct {
 
 	sqlCient *sql.Client
 
+	faultInjector *fault.Injector
+	limiter       *limiter.Limiter
+
 	listenAddress string
 	endpoint      string
+	h2c           bool
+	websocket     WebSocketConfig
+	stream        StreamConfig
+
+	server *http.Server
+
+	mu         sync.Mutex
+	websockets map[*websocket.Conn]struct{}
+	inShutdown bool
+	// stopping is closed on shutdown to finish the streamed responses
+	stopping     chan struct{}
+	stoppingOnce sync.Once
 
 	errorHandler emperror.Handler
 	logger       log.Logger
@@ -43,15 +64,37 @@ type Server struct {
 
 func New(config Config, logger log.Logger, errorHandler emperror.Handler) *Server {
 	logger = logger.WithField("server", "http")
-	return &Server{
+	s := &Server{
 		requests: make([]request.Request, 0),
 
 		listenAddress: config.ListenAddress,
 		endpoint:      config.Endpoint,
+		h2c:           config.H2C,
+		websocket:     config.WebSocket,
+		stream:        config.Stream,
+		limiter:       limiter.New(config.Limits),
+
+		server: &http.Server{
+			Addr: config.ListenAddress,
+		},
+
+		websockets: make(map[*websocket.Conn]struct{}),
+		stopping:   make(chan struct{}),
 
 		errorHandler: errorHandler,
 		logger:       logger,
 	}
+
+	// hijacked WebSocket connections are not tracked by the HTTP server
+	s.server.RegisterOnShutdown(s.closeWebSockets)
+	// the shutdown hooks run on every call of Shutdown
+	s.server.RegisterOnShutdown(func() {
+		s.stoppingOnce.Do(func() {
+			close(s.stopping)
+		})
+	})
+
+	return s
 }
 
 func (s *Server) SetWorkload(workload workload.Workload) {
@@ -67,20 +110,22 @@ func (s *Server) SetSQLClient(client *sql.Client) {
 	s.sqlCient = client
 }
 
+func (s *Server) SetFaultInjector(injector *fault.Injector) {
+	s.faultInjector = injector
+}
+
 func (s *Server) Run() {
 	r := gin.New()
+	r.Use(s.limit)
 	r.GET(s.endpoint, func(c *gin.Context) {
-		s.doRequests(c.Request.Header)
-		if s.sqlCient != nil {
-			go func() {
-				query, err := s.sqlCient.RunQuery(s.logger)
-				if err != nil {
-					s.logger.WithFields(log.Fields{
-						"query": query,
-					}).Error(err)
-				}
-			}()
+		s.logger.WithField("protocol", c.Request.Proto).Info("incoming request")
+
+		if !s.injectFault(c) {
+			return
 		}
+
+		s.doRequests(c)
+		s.runSQLQuery()
 		response, contentType, err := s.runWorkload()
 		if err != nil {
 			ginErr := c.AbortWithError(503, err)
@@ -91,19 +136,85 @@ func (s *Server) Run() {
 		}
 		c.Data(http.StatusOK, contentType, []byte(response))
 	})
-	s.logger.WithField("address", s.listenAddress).Info("starting HTTP server")
-	err := r.Run(s.listenAddress)
-	if err != nil {
+	r.GET(s.websocket.Endpoint, s.handleWebSocket)
+	r.GET(s.stream.Endpoint, s.handleStream)
+	s.server.Handler = r
+	if s.h2c {
+		s.server.Handler = h2c.NewHandler(r, &http2.Server{})
+	}
+
+	s.logger.WithFields(log.Fields{
+		"address": s.listenAddress,
+		"h2c":     s.h2c,
+	}).Info("starting HTTP server")
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.errorHandler.Handle(err)
 	}
 }
 
+// Shutdown stops accepting new connections and waits for the in-flight requests to finish
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down HTTP server")
+
+	return s.server.Shutdown(ctx)
+}
+
+// limit rejects the request with 429 when the rate or concurrency limit is exceeded
+func (s *Server) limit(c *gin.Context) {
+	release, err := s.limiter.Acquire()
+	if err != nil {
+		s.logger.WithField("error", err.Error()).Debug("request rejected")
+		c.AbortWithStatus(http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
+	c.Next()
+}
+
+// injectFault aborts the request with the configured status code when a fault is injected
+func (s *Server) injectFault(c *gin.Context) bool {
+	err := s.faultInjector.Inject(c.Request.Context())
+	if err == nil {
+		return true
+	}
+
+	s.logger.WithField("error", err.Error()).Warn("fault injected")
+	var faultErr fault.Error
+	if errors.As(err, &faultErr) {
+		c.AbortWithStatus(faultErr.Code)
+		return false
+	}
+	c.Abort()
+
+	return false
+}
+
+func (s *Server) runSQLQuery() {
+	if s.sqlCient == nil {
+		return
+	}
+
+	go func() {
+		query, err := s.sqlCient.RunQuery(s.logger)
+		if err != nil {
+			s.logger.WithFields(log.Fields{
+				"query": query,
+			}).Error(err)
+		}
+	}()
+}
+
 func (s *Server) runWorkload() (string, string, error) {
 	if s.workload == nil {
 		return "ok", "text/plain", nil
 	}
 
 	response, contentType, err := s.workload.Execute()
+	if errors.Is(err, workload.ErrNoWorkload) {
+		return "ok", "text/plain", nil
+	}
 	if err != nil {
 		return "", contentType, errors.WrapIf(err, "could not run workload")
 	}
@@ -111,16 +222,25 @@ func (s *Server) runWorkload() (string, string, error) {
 	return response, contentType, nil
 }
 
-func (s *Server) doRequests(incomingRequestHeaders http.Header) {
+func (s *Server) doRequests(c *gin.Context) {
+	incoming := request.Incoming{
+		Headers: c.Request.Header,
+		Path:    c.Request.URL.Path,
+		Params:  make(map[string]string, len(c.Params)),
+	}
+	for _, param := range c.Params {
+		incoming.Params[param.Key] = param.Value
+	}
+
 	var wg sync.WaitGroup
 
-	for _, r := range s.requests {
+	for _, r := range s.requests.Select(incoming) {
 		var i uint
 		for i = 0; i < r.Count(); i++ {
 			wg.Add(1)
 			go func(request request.Request) {
 				defer wg.Done()
-				request.Do(incomingRequestHeaders, s.logger)
+				request.Do(incoming.Headers, s.logger)
 			}(r)
 		}
 	}
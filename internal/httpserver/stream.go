@@ -0,0 +1,141 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+func (s *Server) handleStream(c *gin.Context) {
+	config, err := streamConfig(s.stream, c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger := s.logger.WithFields(log.Fields{
+		"protocol": c.Request.Proto,
+		"format":   config.Format,
+		"events":   config.Events,
+		"size":     config.Size,
+		"interval": config.Interval,
+	})
+	logger.Info("incoming stream request")
+
+	if !s.injectFault(c) {
+		return
+	}
+
+	s.doRequests(c)
+	s.runSQLQuery()
+
+	switch config.Format {
+	case StreamFormatSSE:
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+	default:
+		c.Header("Content-Type", "text/plain")
+	}
+	c.Status(http.StatusOK)
+
+	data := strings.Repeat(".", int(config.Size))
+
+	var sent uint
+	for sent < config.Events {
+		if sent > 0 {
+			select {
+			case <-c.Request.Context().Done():
+				logger.WithField("sent", sent).Warn("stream closed by the client")
+				return
+			case <-s.stopping:
+				logger.WithField("sent", sent).Warn("stream closed on shutdown")
+				return
+			case <-time.After(config.Interval):
+			}
+		}
+
+		var err error
+		switch config.Format {
+		case StreamFormatSSE:
+			_, err = fmt.Fprintf(c.Writer, "id: %d\ndata: %s\n\n", sent, data)
+		default:
+			_, err = c.Writer.WriteString(data)
+		}
+		if err != nil {
+			logger.WithField("sent", sent).Error(errors.WrapIf(err, "could not write event"))
+			return
+		}
+		c.Writer.Flush()
+		sent++
+	}
+
+	logger.WithField("sent", sent).Info("stream finished")
+}
+
+// streamConfig overrides the stream defaults with the query parameters of the request
+func streamConfig(config StreamConfig, c *gin.Context) (StreamConfig, error) {
+	if v := c.Query("format"); v != "" {
+		if !validStreamFormat(v) {
+			return config, emperror.With(errors.New("invalid format"), "format", v)
+		}
+		config.Format = v
+	}
+
+	if v := c.Query("events"); v != "" {
+		events, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return config, errors.WrapIf(err, "invalid events")
+		}
+		if uint(events) > config.MaxEvents {
+			return config, emperror.With(errors.New("events exceed the maximum"), "events", events, "maxEvents", config.MaxEvents)
+		}
+		config.Events = uint(events)
+	}
+
+	if v := c.Query("size"); v != "" {
+		size, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return config, errors.WrapIf(err, "invalid size")
+		}
+		if uint(size) > config.MaxSize {
+			return config, emperror.With(errors.New("size exceeds the maximum"), "size", size, "maxSize", config.MaxSize)
+		}
+		config.Size = uint(size)
+	}
+
+	if v := c.Query("interval"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return config, errors.WrapIf(err, "invalid interval")
+		}
+		// a zero interval would stream the events in a busy loop
+		if interval <= 0 {
+			return config, emperror.With(errors.New("interval must be positive"), "interval", v)
+		}
+		config.Interval = interval
+	}
+
+	return config, nil
+}
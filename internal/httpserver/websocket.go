@@ -0,0 +1,177 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"net/http"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const websocketCloseTimeout = time.Second
+
+var upgrader = websocket.Upgrader{
+	// allspark is a demo service, connections are accepted from any origin
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+func (s *Server) handleWebSocket(c *gin.Context) {
+	if !s.injectFault(c) {
+		return
+	}
+
+	s.doRequests(c)
+	s.runSQLQuery()
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		s.logger.WithField("error", err.Error()).Warn("could not upgrade connection")
+		return
+	}
+	defer conn.Close()
+
+	if !s.trackWebSocket(conn, true) {
+		s.closeWebSocket(conn, websocket.CloseGoingAway)
+		return
+	}
+	defer s.trackWebSocket(conn, false)
+
+	logger := s.logger.WithFields(log.Fields{
+		"remoteAddress": conn.RemoteAddr().String(),
+		"mode":          s.websocket.Mode,
+	})
+	logger.Info("incoming WebSocket connection")
+
+	var messages uint
+	switch s.websocket.Mode {
+	case WebSocketModeStream:
+		messages, err = s.streamWebSocket(conn)
+	default:
+		messages, err = echoWebSocket(conn)
+	}
+	if err != nil {
+		logger.WithField("messages", messages).Error(err)
+		return
+	}
+	logger.WithField("messages", messages).Info("WebSocket connection closed")
+}
+
+// echoWebSocket sends every message back until the client closes the connection
+func echoWebSocket(conn *websocket.Conn) (uint, error) {
+	var messages uint
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, errors.WrapIf(err, "could not read message")
+		}
+		if err := conn.WriteMessage(messageType, data); err != nil {
+			return messages, errors.WrapIf(err, "could not write message")
+		}
+		messages++
+	}
+}
+
+// streamWebSocket sends the output of the workload periodically until the
+// configured number of messages is sent or the client closes the connection
+func (s *Server) streamWebSocket(conn *websocket.Conn) (uint, error) {
+	// the messages of the client have to be read to process the control frames
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.websocket.Interval)
+	defer ticker.Stop()
+
+	var messages uint
+	for s.websocket.Messages == 0 || messages < s.websocket.Messages {
+		response, _, err := s.runWorkload()
+		if err != nil {
+			s.closeWebSocket(conn, websocket.CloseInternalServerErr)
+			return messages, err
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(response)); err != nil {
+			return messages, errors.WrapIf(err, "could not write message")
+		}
+		messages++
+
+		select {
+		case err := <-closed:
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return messages, nil
+			}
+			return messages, errors.WrapIf(err, "could not read message")
+		case <-ticker.C:
+		}
+	}
+
+	s.closeWebSocket(conn, websocket.CloseNormalClosure)
+
+	// wait for the client to acknowledge the close frame
+	select {
+	case <-closed:
+	case <-time.After(websocketCloseTimeout):
+	}
+
+	return messages, nil
+}
+
+func (s *Server) closeWebSocket(conn *websocket.Conn, code int) {
+	message := websocket.FormatCloseMessage(code, "")
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(websocketCloseTimeout)); err != nil {
+		s.logger.WithField("error", err.Error()).Debug("could not send close frame")
+	}
+}
+
+func (s *Server) trackWebSocket(conn *websocket.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		if s.inShutdown {
+			return false
+		}
+		s.websockets[conn] = struct{}{}
+	} else {
+		delete(s.websockets, conn)
+	}
+
+	return true
+}
+
+// closeWebSockets asks the clients of the active WebSocket connections to close them
+func (s *Server) closeWebSockets() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inShutdown = true
+	for conn := range s.websockets {
+		s.closeWebSocket(conn, websocket.CloseGoingAway)
+	}
+}
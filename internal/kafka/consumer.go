@@ -43,6 +43,40 @@ func NewConsumer(bootStrapServer string, topic string, consumerGroup string, log
 }
 
 func (c *Consumer) Consume(ctx context.Context) (*kafka.Message, error) {
+	// the `ReadMessage` method blocks until we receive the next event
+	message, err := c.getReader().ReadMessage(ctx)
+	if err != nil {
+		if err := c.reader.Close(); err != nil {
+			return nil, errors.WrapIf(err, "failed to close kafka reader")
+		}
+		return nil, errors.WrapIf(err, "could not read kafka message")
+	}
+
+	return &message, nil
+}
+
+// Fetch reads the next message without committing its offset, the message
+// must be committed using Commit once it is processed
+func (c *Consumer) Fetch(ctx context.Context) (*kafka.Message, error) {
+	message, err := c.getReader().FetchMessage(ctx)
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not fetch kafka message")
+	}
+
+	return &message, nil
+}
+
+// Commit commits the offset of the given message
+func (c *Consumer) Commit(ctx context.Context, message *kafka.Message) error {
+	err := c.getReader().CommitMessages(ctx, *message)
+	if err != nil {
+		return errors.WrapIf(err, "could not commit kafka message")
+	}
+
+	return nil
+}
+
+func (c *Consumer) getReader() *kafka.Reader {
 	if c.reader == nil {
 		c.reader = kafka.NewReader(kafka.ReaderConfig{
 			Brokers: []string{c.BootstrapServer},
@@ -53,16 +87,7 @@ func (c *Consumer) Consume(ctx context.Context) (*kafka.Message, error) {
 		})
 	}
 
-	// the `ReadMessage` method blocks until we receive the next event
-	message, err := c.reader.ReadMessage(ctx)
-	if err != nil {
-		if err := c.reader.Close(); err != nil {
-			return nil, errors.WrapIf(err, "failed to close kafka reader")
-		}
-		return nil, errors.WrapIf(err, "could not read kafka message")
-	}
-
-	return &message, nil
+	return c.reader
 }
 
 func (c *Consumer) SetLogger(log log.Logger) {
@@ -70,9 +95,32 @@ func (c *Consumer) SetLogger(log log.Logger) {
 }
 
 func (c *Consumer) Close() error {
+	if c.reader == nil {
+		return nil
+	}
+
 	return c.reader.Close()
 }
 
+// CheckBroker verifies that the Kafka broker is reachable and responds to metadata requests
+func CheckBroker(ctx context.Context, bootstrapServer string) error {
+	conn, err := kafka.DefaultDialer.DialContext(ctx, "tcp", bootstrapServer)
+	if err != nil {
+		return errors.WrapIf(err, "could not connect to kafka broker")
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline) // nolint:errcheck
+	}
+
+	if _, err := conn.Brokers(); err != nil {
+		return errors.WrapIf(err, "could not get kafka brokers")
+	}
+
+	return nil
+}
+
 func (c *Consumer) Validate() (*Consumer, error) {
 	if c.ConsumerGroup == "" {
 		c.ConsumerGroup = "allspark-consumer-group"
@@ -21,6 +21,7 @@ import (
 
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
+	"github.com/banzaicloud/allspark/internal/fault"
 	"github.com/banzaicloud/allspark/internal/kafka"
 	"github.com/banzaicloud/allspark/internal/platform/log"
 	"github.com/banzaicloud/allspark/internal/request"
@@ -29,6 +30,10 @@ import (
 	segmentiokafka "github.com/segmentio/kafka-go"
 )
 
+// maxInFlightMessages bounds the messages handled at the same time, the next
+// message is fetched once one of them is finished
+const maxInFlightMessages = 64
+
 type Server struct {
 	// the kafka Server acts as a consumer to handle incoming messages
 	consumer *kafka.Consumer
@@ -38,15 +43,32 @@ type Server struct {
 
 	sqlClient *sql.Client
 
+	faultInjector *fault.Injector
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	// offsets receives the fetched and the processed messages in order to commit them
+	offsets   chan offsetEvent
+	committed chan struct{}
+
 	errorHandler emperror.Handler
 	logger       log.Logger
 }
 
 func New(consumer *kafka.Consumer, logger log.Logger, errorHandler emperror.Handler) *Server {
 	logger = logger.WithField("server", "kafka")
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		consumer:     consumer,
 		requests:     make(request.Requests, 0),
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		offsets:      make(chan offsetEvent),
+		committed:    make(chan struct{}),
 		logger:       logger,
 		errorHandler: errorHandler,
 	}
@@ -65,31 +87,143 @@ func (s *Server) SetSQLClient(client *sql.Client) {
 	s.sqlClient = client
 }
 
+func (s *Server) SetFaultInjector(injector *fault.Injector) {
+	s.faultInjector = injector
+}
+
+// offsetEvent is sent to the committer when a message is fetched or processed
+type offsetEvent struct {
+	message   *segmentiokafka.Message
+	processed bool
+}
+
 func (s *Server) Run() {
-	defer func() {
-		err := s.consumer.Close()
-		if err != nil {
-			s.logger.Error(errors.WrapIf(err, "could not close kafka server"))
+	defer close(s.done)
+	go s.commit()
+
+	inFlight := make(chan struct{}, maxInFlightMessages)
+	for {
+		select {
+		case inFlight <- struct{}{}:
+		case <-s.ctx.Done():
 			return
 		}
-	}()
-	for {
-		message, err := s.consumer.Consume(context.Background())
+
+		message, err := s.consumer.Fetch(s.ctx)
 		if err != nil {
-			s.errorHandler.Handle(errors.WrapIf(err, "could not consume"))
+			if s.ctx.Err() == nil {
+				s.errorHandler.Handle(errors.WrapIf(err, "could not consume"))
+			}
 			return
 		}
-		go s.Incoming(message)
+		s.offsets <- offsetEvent{message: message}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-inFlight }()
+			s.Incoming(message)
+			s.offsets <- offsetEvent{message: message, processed: true}
+		}()
 	}
 }
 
+// commit commits the offsets of the processed messages in the order they were
+// fetched per partition, so a crash never skips a message still being processed
+func (s *Server) commit() {
+	defer close(s.committed)
+
+	pending := make(map[int][]*segmentiokafka.Message)
+	processed := make(map[*segmentiokafka.Message]bool)
+	for event := range s.offsets {
+		partition := event.message.Partition
+		if !event.processed {
+			pending[partition] = append(pending[partition], event.message)
+			continue
+		}
+		processed[event.message] = true
+
+		// commit the highest offset whose preceding messages are all processed
+		var last *segmentiokafka.Message
+		queue := pending[partition]
+		for len(queue) > 0 && processed[queue[0]] {
+			last = queue[0]
+			delete(processed, last)
+			queue = queue[1:]
+		}
+		pending[partition] = queue
+
+		if last != nil {
+			if err := s.consumer.Commit(context.Background(), last); err != nil {
+				s.errorHandler.Handle(err)
+			}
+		}
+	}
+}
+
+// Shutdown stops consuming new messages, waits for the in-flight ones to be
+// processed and committed, then closes the consumer
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down kafka server")
+
+	s.cancel()
+
+	err := s.drain(ctx)
+	if closeErr := s.consumer.Close(); closeErr != nil {
+		err = errors.Append(err, errors.WrapIf(closeErr, "could not close kafka server"))
+	}
+
+	return err
+}
+
+// drain waits for the consumer to stop, then for the in-flight messages to be processed and committed
+func (s *Server) drain(ctx context.Context) error {
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return errors.WrapIf(ctx.Err(), "could not stop kafka consumer")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(s.offsets)
+		<-s.committed
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return errors.WrapIf(ctx.Err(), "could not drain kafka messages")
+	}
+
+	return nil
+}
+
 func (s *Server) Incoming(_ *segmentiokafka.Message) {
 	s.logger.Info("incoming kafka consumer message")
 
-	go s.doRequests(nil)
+	// the injected latency is not cut short on shutdown, as the message is
+	// committed as processed once Incoming returns
+	if err := s.faultInjector.Inject(context.Background()); err != nil {
+		s.logger.WithField("error", err.Error()).Warn("fault injected")
+		return
+	}
+
+	// the message is committed once the subsequent requests and the query are done
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.doRequests(nil)
+	}()
 
 	if s.sqlClient != nil {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			query, err := s.sqlClient.RunQuery(s.logger)
 			if err != nil {
 				s.logger.WithFields(log.Fields{
@@ -104,7 +238,7 @@ func (s *Server) Incoming(_ *segmentiokafka.Message) {
 	}
 
 	_, _, err := s.workload.Execute()
-	if err != nil {
+	if err != nil && !errors.Is(err, workload.ErrNoWorkload) {
 		s.errorHandler.Handle(errors.WrapIf(err, "could not run workload"))
 	}
 }
@@ -112,7 +246,8 @@ func (s *Server) Incoming(_ *segmentiokafka.Message) {
 func (s *Server) doRequests(incomingRequestHeaders http.Header) {
 	var wg sync.WaitGroup
 
-	for _, r := range s.requests {
+	// path conditions never match as there is no incoming path
+	for _, r := range s.requests.Select(request.Incoming{Headers: incomingRequestHeaders}) {
 		var i uint
 		for i = 0; i < r.Count(); i++ {
 			wg.Add(1)
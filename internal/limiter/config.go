@@ -0,0 +1,44 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"math"
+
+	"emperror.dev/errors"
+)
+
+type Config struct {
+	// Rate is the number of requests allowed per second, unlimited if not set
+	Rate float64 `mapstructure:"rate"`
+	// Burst is the size of the token bucket, defaults to the rate rounded up
+	Burst int `mapstructure:"burst"`
+
+	// MaxInFlight limits the number of concurrently handled requests, unlimited if not set
+	MaxInFlight int `mapstructure:"maxInFlight"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.Rate < 0 || c.Burst < 0 || c.MaxInFlight < 0 {
+		return c, errors.New("limits must not be negative")
+	}
+
+	if c.Rate > 0 && c.Burst == 0 {
+		c.Burst = int(math.Ceil(c.Rate))
+	}
+
+	return c, nil
+}
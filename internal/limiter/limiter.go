@@ -0,0 +1,76 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"emperror.dev/errors"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrRateLimited is returned when the request rate exceeds the configured rate
+	ErrRateLimited = errors.NewPlain("rate limit exceeded")
+	// ErrTooManyInFlight is returned when the maximum number of in-flight requests is reached
+	ErrTooManyInFlight = errors.NewPlain("too many requests in flight")
+)
+
+// Limiter limits the rate and the concurrency of the incoming requests
+type Limiter struct {
+	rate     *rate.Limiter
+	inFlight chan struct{}
+}
+
+// New creates a limiter, it returns nil if no limit is configured
+func New(config Config) *Limiter {
+	if config.Rate == 0 && config.MaxInFlight == 0 {
+		return nil
+	}
+
+	l := &Limiter{}
+	if config.Rate > 0 {
+		l.rate = rate.NewLimiter(rate.Limit(config.Rate), config.Burst)
+	}
+	if config.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, config.MaxInFlight)
+	}
+
+	return l
+}
+
+// Acquire reserves capacity for a request without waiting, the returned
+// function must be called when the request is finished
+func (l *Limiter) Acquire() (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	// the in-flight slot is taken first, so rejected requests never consume rate tokens
+	release := func() {}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+			release = func() { <-l.inFlight }
+		default:
+			return nil, ErrTooManyInFlight
+		}
+	}
+
+	if l.rate != nil && !l.rate.Allow() {
+		release()
+		return nil, ErrRateLimited
+	}
+
+	return release, nil
+}
@@ -0,0 +1,86 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+)
+
+const (
+	// ReportText is a human readable report
+	ReportText = "text"
+	// ReportJSON is a machine readable report
+	ReportJSON = "json"
+)
+
+type Config struct {
+	// RPS is the number of requests sent per second
+	RPS float64 `mapstructure:"rps"`
+	// Concurrency is the number of workers sending requests one after the other,
+	// when RPS is also set the workers share the rate
+	Concurrency int `mapstructure:"concurrency"`
+
+	// Duration is how long the load is generated after the ramp-up
+	Duration time.Duration `mapstructure:"duration"`
+	// RampUp is how long the load is increased linearly at the start of the run
+	RampUp time.Duration `mapstructure:"rampUp"`
+	// WarmUp is the leading part of the run whose requests are not included in the report
+	WarmUp time.Duration `mapstructure:"warmUp"`
+
+	// Report is the format of the report
+	// Accepted values are: text, json
+	Report string `mapstructure:"report"`
+	// ReportFile is the path the report is written to instead of the standard output
+	ReportFile string `mapstructure:"reportFile"`
+
+	// LogRequests enables the logging of every request
+	LogRequests bool `mapstructure:"logRequests"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.RPS < 0 || c.Concurrency < 0 {
+		return c, errors.New("rps and concurrency must not be negative")
+	}
+
+	if c.RPS == 0 && c.Concurrency == 0 {
+		c.Concurrency = 1
+	}
+
+	if c.Duration == 0 {
+		c.Duration = 10 * time.Second
+	}
+
+	if c.Duration < 0 || c.RampUp < 0 || c.WarmUp < 0 {
+		return c, errors.New("durations must not be negative")
+	}
+
+	if c.WarmUp >= c.RampUp+c.Duration {
+		return c, errors.New("warm-up must be shorter than the run")
+	}
+
+	if c.Report == "" {
+		c.Report = ReportText
+	}
+
+	if c.Report != ReportText && c.Report != ReportJSON {
+		return c, emperror.With(errors.New("invalid report format"), "format", c.Report)
+	}
+
+	return c, nil
+}
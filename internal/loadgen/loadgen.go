@@ -0,0 +1,246 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+)
+
+// rampInterval is how often the rate is recalculated while waiting for the next request
+const rampInterval = 100 * time.Millisecond
+
+// Generator sends the configured requests at a fixed rate or concurrency
+type Generator struct {
+	config Config
+
+	requests request.Requests
+
+	// pending holds the rest of the requests selected for the current iteration
+	mu      sync.Mutex
+	pending []request.Request
+
+	logger        log.Logger
+	requestLogger log.Logger
+}
+
+func New(config Config, requests request.Requests, logger log.Logger) (*Generator, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("no requests to send")
+	}
+
+	g := &Generator{
+		config:   config,
+		requests: requests,
+		logger:   logger.WithField("component", "loadgen"),
+	}
+
+	g.requestLogger = log.NewNopLogger()
+	if config.LogRequests {
+		g.requestLogger = g.logger
+	}
+
+	return g, nil
+}
+
+// Run generates the load until the end of the run or until the context is
+// cancelled, then waits for the in-flight requests and returns the report
+func (g *Generator) Run(ctx context.Context) Report {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, g.config.RampUp+g.config.Duration)
+	defer cancel()
+
+	g.logger.WithFields(log.Fields{
+		"rps":         g.config.RPS,
+		"concurrency": g.config.Concurrency,
+		"duration":    g.config.Duration,
+		"rampUp":      g.config.RampUp,
+		"warmUp":      g.config.WarmUp,
+	}).Info("starting load generation")
+
+	r := newRecorder(start.Add(g.config.WarmUp))
+
+	var p *pacer
+	if g.config.RPS > 0 {
+		p = &pacer{
+			start: start,
+			rate:  g.rampedRate,
+		}
+	}
+
+	var wg sync.WaitGroup
+	if g.config.Concurrency > 0 {
+		for i := 0; i < g.config.Concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				g.worker(ctx, p, g.workerDelay(i, p), r)
+			}(i)
+		}
+	} else {
+		for p.wait(ctx) == nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.send(r)
+			}()
+		}
+	}
+
+	<-ctx.Done()
+	end := time.Now()
+	g.logger.Info("waiting for the in-flight requests")
+	wg.Wait()
+
+	return r.report(end)
+}
+
+func (g *Generator) worker(ctx context.Context, p *pacer, delay time.Duration, r *recorder) {
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	for ctx.Err() == nil {
+		if p != nil {
+			if err := p.wait(ctx); err != nil {
+				return
+			}
+		}
+		// back off when the rules select nothing, instead of spinning
+		if !g.send(r) && p == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(rampInterval):
+			}
+		}
+	}
+}
+
+// workerDelay spreads the start of the workers over the ramp-up, unless the
+// rate is ramped up instead
+func (g *Generator) workerDelay(i int, p *pacer) time.Duration {
+	if p != nil || g.config.RampUp == 0 {
+		return 0
+	}
+
+	return g.config.RampUp * time.Duration(i) / time.Duration(g.config.Concurrency)
+}
+
+// rampedRate is the rate at the given time of the run, it never drops to zero
+// so the pacer keeps letting requests through
+func (g *Generator) rampedRate(elapsed time.Duration) float64 {
+	if g.config.RampUp == 0 || elapsed >= g.config.RampUp {
+		return g.config.RPS
+	}
+
+	return math.Max(g.config.RPS*float64(elapsed)/float64(g.config.RampUp), math.Min(g.config.RPS, 1))
+}
+
+// send sends the next request and reports whether there was any to send
+func (g *Generator) send(r *recorder) bool {
+	req := g.nextRequest()
+	if req == nil {
+		return false
+	}
+
+	start := time.Now()
+	err := req.Do(nil, g.requestLogger)
+	r.record(start, time.Since(start), err)
+
+	return true
+}
+
+// nextRequest returns the next request of the current iteration; every iteration selects
+// the requests like an incoming request without headers and path, so the probability
+// and match rules and the alternatives apply, and each selected request is sent as
+// many times as its count
+func (g *Generator) nextRequest() request.Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.pending) == 0 {
+		for _, r := range g.requests.Select(request.Incoming{}) {
+			for i := uint(0); i < r.Count(); i++ {
+				g.pending = append(g.pending, r)
+			}
+		}
+		if len(g.pending) == 0 {
+			return nil
+		}
+	}
+
+	req := g.pending[0]
+	g.pending = g.pending[1:]
+
+	return req
+}
+
+// pacer spaces the requests according to a rate which may change over time
+type pacer struct {
+	mu    sync.Mutex
+	start time.Time
+	last  time.Time
+	rate  func(elapsed time.Duration) float64
+}
+
+// wait blocks until the next request is due, the rate is recalculated
+// periodically so that a slow initial rate does not delay the ramp-up
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if p.last.IsZero() {
+			p.last = now
+			return nil
+		}
+
+		next := p.last.Add(time.Duration(float64(time.Second) / p.rate(now.Sub(p.start))))
+		if !now.Before(next) {
+			// do not try to catch up when falling behind the schedule
+			if now.Sub(next) > rampInterval {
+				next = now
+			}
+			p.last = next
+			return nil
+		}
+
+		wait := next.Sub(now)
+		if wait > rampInterval {
+			wait = rampInterval
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/request"
+)
+
+// Report summarizes the requests sent after the warm-up
+type Report struct {
+	Requests       uint64  `json:"requests"`
+	Succeeded      uint64  `json:"succeeded"`
+	Failed         uint64  `json:"failed"`
+	WarmUpRequests uint64  `json:"warmUpRequests"`
+	Duration       float64 `json:"durationSeconds"`
+	// Throughput is the number of requests per second
+	Throughput float64 `json:"throughput"`
+
+	// Latency holds the latency statistics of the succeeded requests in milliseconds
+	Latency Latency `json:"latencyMs"`
+
+	// Errors is the number of failed requests per error class, e.g. status code 503
+	// or assertion expectBody, other errors are counted as transport errors
+	Errors map[string]uint64 `json:"errors"`
+	// AssertionFailures is the number of failed requests whose response did not meet an assertion
+	AssertionFailures uint64 `json:"assertionFailures"`
+}
+
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+	Max  float64 `json:"max"`
+}
+
+// Write writes the report in the given format
+func (r Report) Write(w io.Writer, format string) error {
+	if format == ReportJSON {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+
+		return e.Encode(r)
+	}
+
+	return r.writeText(w)
+}
+
+func (r Report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Requests:\t%d (%d succeeded, %d failed, %d during warm-up)\n", r.Requests, r.Succeeded, r.Failed, r.WarmUpRequests)
+	if r.AssertionFailures > 0 {
+		fmt.Fprintf(tw, "Assertions:\t%d failed\n", r.AssertionFailures)
+	}
+	fmt.Fprintf(tw, "Duration:\t%.2fs\n", r.Duration)
+	fmt.Fprintf(tw, "Throughput:\t%.2f req/s\n", r.Throughput)
+	fmt.Fprintf(tw, "Latency:\tmin %.2fms\tmean %.2fms\tmax %.2fms\n", r.Latency.Min, r.Latency.Mean, r.Latency.Max)
+	fmt.Fprintf(tw, "\tp50 %.2fms\tp90 %.2fms\tp95 %.2fms\tp99 %.2fms\tp99.9 %.2fms\n", r.Latency.P50, r.Latency.P90, r.Latency.P95, r.Latency.P99, r.Latency.P999)
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(tw, "Errors:")
+		messages := make([]string, 0, len(r.Errors))
+		for message := range r.Errors {
+			messages = append(messages, message)
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			return r.Errors[messages[i]] > r.Errors[messages[j]]
+		})
+		for _, message := range messages {
+			fmt.Fprintf(tw, "\t%d\t%s\n", r.Errors[message], message)
+		}
+	}
+
+	return tw.Flush()
+}
+
+const (
+	// maxErrorClasses bounds the number of error classes, the errors of further classes are counted as other
+	maxErrorClasses = 32
+
+	errorClassTransport = "transport"
+	errorClassOther     = "other"
+)
+
+// errorClass returns the class of the error the failed requests are counted by
+func errorClass(err error) string {
+	var assertionErr request.AssertionError
+	var statusCodeErr request.StatusCodeError
+	switch {
+	case errors.Is(err, request.ErrCircuitOpen):
+		return "circuit breaker open"
+	case errors.As(err, &assertionErr):
+		return "assertion " + assertionErr.Assertion
+	case errors.As(err, &statusCodeErr):
+		return fmt.Sprintf("status code %d", statusCodeErr.Code)
+	default:
+		return errorClassTransport
+	}
+}
+
+// recorder collects the results of the requests sent after the warm-up
+type recorder struct {
+	mu sync.Mutex
+
+	measureFrom time.Time
+	latencies   []time.Duration
+	errors      map[string]uint64
+	failed      uint64
+	assertions  uint64
+	warmUp      uint64
+}
+
+func newRecorder(measureFrom time.Time) *recorder {
+	return &recorder{
+		measureFrom: measureFrom,
+		errors:      make(map[string]uint64),
+	}
+}
+
+func (r *recorder) record(start time.Time, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if start.Before(r.measureFrom) {
+		r.warmUp++
+		return
+	}
+
+	if err != nil {
+		r.failed++
+		class := errorClass(err)
+		if _, ok := r.errors[class]; !ok && len(r.errors) >= maxErrorClasses {
+			class = errorClassOther
+		}
+		r.errors[class]++
+		if errors.As(err, &request.AssertionError{}) {
+			r.assertions++
+		}
+		return
+	}
+
+	r.latencies = append(r.latencies, latency)
+}
+
+func (r *recorder) report(end time.Time) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Succeeded:      uint64(len(r.latencies)),
+		Failed:         r.failed,
+		WarmUpRequests: r.warmUp,
+		Errors:         r.errors,
+
+		AssertionFailures: r.assertions,
+	}
+	report.Requests = report.Succeeded + report.Failed
+
+	if d := end.Sub(r.measureFrom); d > 0 {
+		report.Duration = d.Seconds()
+		report.Throughput = float64(report.Requests) / d.Seconds()
+	}
+
+	if len(r.latencies) == 0 {
+		return report
+	}
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	var sum time.Duration
+	for _, l := range r.latencies {
+		sum += l
+	}
+	report.Latency = Latency{
+		Min:  milliseconds(r.latencies[0]),
+		Mean: milliseconds(sum / time.Duration(len(r.latencies))),
+		P50:  milliseconds(percentile(r.latencies, 50)),
+		P90:  milliseconds(percentile(r.latencies, 90)),
+		P95:  milliseconds(percentile(r.latencies, 95)),
+		P99:  milliseconds(percentile(r.latencies, 99)),
+		P999: milliseconds(percentile(r.latencies, 99.9)),
+		Max:  milliseconds(r.latencies[len(r.latencies)-1]),
+	}
+
+	return report
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
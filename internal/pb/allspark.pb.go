@@ -1,150 +1,368 @@
-// Code generated by protoc-gen-go.
-// source: allspark.proto
-// DO NOT EDIT!
-
-/*
-Package pb is a generated protocol buffer package.
+// Copyright © 2019 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
 
-It is generated from these files:
-	allspark.proto
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.0
+// 	protoc        (unknown)
+// source: allspark.proto
 
-It has these top-level messages:
-	Params
-	Msg
-*/
 package pb
 
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
-
 import (
-	context "golang.org/x/net/context"
-	grpc "google.golang.org/grpc"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
 )
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ = proto.Marshal
-var _ = fmt.Errorf
-var _ = math.Inf
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-// A compilation error at this line likely means your copy of the
-// proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
 
 type Params struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// payload carried by the request
+	Payload []byte `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	// hints on how the server should respond
+	Hints *Hints `protobuf:"bytes,2,opt,name=hints,proto3" json:"hints,omitempty"`
 }
 
-func (m *Params) Reset()                    { *m = Params{} }
-func (m *Params) String() string            { return proto.CompactTextString(m) }
-func (*Params) ProtoMessage()               {}
-func (*Params) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+func (x *Params) Reset() {
+	*x = Params{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_allspark_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
 
-type Msg struct {
-	Response string `protobuf:"bytes,1,opt,name=response" json:"response,omitempty"`
+func (x *Params) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (m *Msg) Reset()                    { *m = Msg{} }
-func (m *Msg) String() string            { return proto.CompactTextString(m) }
-func (*Msg) ProtoMessage()               {}
-func (*Msg) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*Params) ProtoMessage() {}
 
-func (m *Msg) GetResponse() string {
-	if m != nil {
-		return m.Response
+func (x *Params) ProtoReflect() protoreflect.Message {
+	mi := &file_allspark_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return ""
+	return mi.MessageOf(x)
 }
 
-func init() {
-	proto.RegisterType((*Params)(nil), "params")
-	proto.RegisterType((*Msg)(nil), "msg")
+// Deprecated: Use Params.ProtoReflect.Descriptor instead.
+func (*Params) Descriptor() ([]byte, []int) {
+	return file_allspark_proto_rawDescGZIP(), []int{0}
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
+func (x *Params) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
+func (x *Params) GetHints() *Hints {
+	if x != nil {
+		return x.Hints
+	}
+	return nil
+}
 
-// Client API for Allspark service
+type Hints struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-type AllsparkClient interface {
-	Incoming(ctx context.Context, in *Params, opts ...grpc.CallOption) (*Msg, error)
+	// echo the request payload back in the response
+	Echo bool `protobuf:"varint,1,opt,name=echo,proto3" json:"echo,omitempty"`
+	// size of the generated response payload in bytes, ignored if echo is set
+	ResponseSize uint32 `protobuf:"varint,2,opt,name=response_size,json=responseSize,proto3" json:"response_size,omitempty"`
+	// number of messages sent by the server on a server stream
+	MessageCount uint32 `protobuf:"varint,3,opt,name=message_count,json=messageCount,proto3" json:"message_count,omitempty"`
+	// delay between the messages sent by the server in milliseconds
+	MessageIntervalMs uint32 `protobuf:"varint,4,opt,name=message_interval_ms,json=messageIntervalMs,proto3" json:"message_interval_ms,omitempty"`
 }
 
-type allsparkClient struct {
-	cc *grpc.ClientConn
+func (x *Hints) Reset() {
+	*x = Hints{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_allspark_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
 }
 
-func NewAllsparkClient(cc *grpc.ClientConn) AllsparkClient {
-	return &allsparkClient{cc}
+func (x *Hints) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func (c *allsparkClient) Incoming(ctx context.Context, in *Params, opts ...grpc.CallOption) (*Msg, error) {
-	out := new(Msg)
-	err := grpc.Invoke(ctx, "/allspark/Incoming", in, out, c.cc, opts...)
-	if err != nil {
-		return nil, err
+func (*Hints) ProtoMessage() {}
+
+func (x *Hints) ProtoReflect() protoreflect.Message {
+	mi := &file_allspark_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return out, nil
+	return mi.MessageOf(x)
 }
 
-// Server API for Allspark service
+// Deprecated: Use Hints.ProtoReflect.Descriptor instead.
+func (*Hints) Descriptor() ([]byte, []int) {
+	return file_allspark_proto_rawDescGZIP(), []int{1}
+}
 
-type AllsparkServer interface {
-	Incoming(context.Context, *Params) (*Msg, error)
+func (x *Hints) GetEcho() bool {
+	if x != nil {
+		return x.Echo
+	}
+	return false
 }
 
-func RegisterAllsparkServer(s *grpc.Server, srv AllsparkServer) {
-	s.RegisterService(&_Allspark_serviceDesc, srv)
+func (x *Hints) GetResponseSize() uint32 {
+	if x != nil {
+		return x.ResponseSize
+	}
+	return 0
 }
 
-func _Allspark_Incoming_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Params)
-	if err := dec(in); err != nil {
-		return nil, err
+func (x *Hints) GetMessageCount() uint32 {
+	if x != nil {
+		return x.MessageCount
 	}
-	if interceptor == nil {
-		return srv.(AllsparkServer).Incoming(ctx, in)
+	return 0
+}
+
+func (x *Hints) GetMessageIntervalMs() uint32 {
+	if x != nil {
+		return x.MessageIntervalMs
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/allspark/Incoming",
+	return 0
+}
+
+type Msg struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Response string `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// payload carried by the response
+	Payload []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	// sequence number of the message within a stream, starting from 1
+	Sequence uint32 `protobuf:"varint,3,opt,name=sequence,proto3" json:"sequence,omitempty"`
+}
+
+func (x *Msg) Reset() {
+	*x = Msg{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_allspark_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(AllsparkServer).Incoming(ctx, req.(*Params))
+}
+
+func (x *Msg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Msg) ProtoMessage() {}
+
+func (x *Msg) ProtoReflect() protoreflect.Message {
+	mi := &file_allspark_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Msg.ProtoReflect.Descriptor instead.
+func (*Msg) Descriptor() ([]byte, []int) {
+	return file_allspark_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Msg) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *Msg) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Msg) GetSequence() uint32 {
+	if x != nil {
+		return x.Sequence
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
+}
+
+var File_allspark_proto protoreflect.FileDescriptor
+
+var file_allspark_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x61, 0x6c, 0x6c, 0x73, 0x70, 0x61, 0x72, 0x6b, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0x40, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x70, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1c, 0x0a, 0x05, 0x68, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x06, 0x2e, 0x68, 0x69, 0x6e, 0x74, 0x73, 0x52, 0x05, 0x68, 0x69, 0x6e,
+	0x74, 0x73, 0x22, 0x95, 0x01, 0x0a, 0x05, 0x68, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x12, 0x0a, 0x04,
+	0x65, 0x63, 0x68, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x65, 0x63, 0x68, 0x6f,
+	0x12, 0x23, 0x0a, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x73, 0x69, 0x7a,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x2e, 0x0a, 0x13, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x5f, 0x6d,
+	0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x11, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73, 0x22, 0x57, 0x0a, 0x03, 0x6d, 0x73,
+	0x67, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a,
+	0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07,
+	0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x73, 0x65, 0x71, 0x75, 0x65,
+	0x6e, 0x63, 0x65, 0x32, 0x88, 0x01, 0x0a, 0x08, 0x61, 0x6c, 0x6c, 0x73, 0x70, 0x61, 0x72, 0x6b,
+	0x12, 0x19, 0x0a, 0x08, 0x49, 0x6e, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x12, 0x07, 0x2e, 0x70,
+	0x61, 0x72, 0x61, 0x6d, 0x73, 0x1a, 0x04, 0x2e, 0x6d, 0x73, 0x67, 0x12, 0x1f, 0x0a, 0x0c, 0x53,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x07, 0x2e, 0x70, 0x61,
+	0x72, 0x61, 0x6d, 0x73, 0x1a, 0x04, 0x2e, 0x6d, 0x73, 0x67, 0x30, 0x01, 0x12, 0x1f, 0x0a, 0x0c,
+	0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x07, 0x2e, 0x70,
+	0x61, 0x72, 0x61, 0x6d, 0x73, 0x1a, 0x04, 0x2e, 0x6d, 0x73, 0x67, 0x28, 0x01, 0x12, 0x1f, 0x0a,
+	0x0a, 0x42, 0x69, 0x64, 0x69, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x07, 0x2e, 0x70, 0x61,
+	0x72, 0x61, 0x6d, 0x73, 0x1a, 0x04, 0x2e, 0x6d, 0x73, 0x67, 0x28, 0x01, 0x30, 0x01, 0x42, 0x2d,
+	0x5a, 0x2b, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x62, 0x61, 0x6e,
+	0x7a, 0x61, 0x69, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x2f, 0x61, 0x6c, 0x6c, 0x73, 0x70, 0x61, 0x72,
+	0x6b, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_allspark_proto_rawDescOnce sync.Once
+	file_allspark_proto_rawDescData = file_allspark_proto_rawDesc
+)
+
+func file_allspark_proto_rawDescGZIP() []byte {
+	file_allspark_proto_rawDescOnce.Do(func() {
+		file_allspark_proto_rawDescData = protoimpl.X.CompressGZIP(file_allspark_proto_rawDescData)
+	})
+	return file_allspark_proto_rawDescData
 }
 
-var _Allspark_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "allspark",
-	HandlerType: (*AllsparkServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Incoming",
-			Handler:    _Allspark_Incoming_Handler,
+var file_allspark_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_allspark_proto_goTypes = []interface{}{
+	(*Params)(nil), // 0: params
+	(*Hints)(nil),  // 1: hints
+	(*Msg)(nil),    // 2: msg
+}
+var file_allspark_proto_depIdxs = []int32{
+	1, // 0: params.hints:type_name -> hints
+	0, // 1: allspark.Incoming:input_type -> params
+	0, // 2: allspark.ServerStream:input_type -> params
+	0, // 3: allspark.ClientStream:input_type -> params
+	0, // 4: allspark.BidiStream:input_type -> params
+	2, // 5: allspark.Incoming:output_type -> msg
+	2, // 6: allspark.ServerStream:output_type -> msg
+	2, // 7: allspark.ClientStream:output_type -> msg
+	2, // 8: allspark.BidiStream:output_type -> msg
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_allspark_proto_init() }
+func file_allspark_proto_init() {
+	if File_allspark_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_allspark_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Params); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_allspark_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Hints); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_allspark_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Msg); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_allspark_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
 		},
-	},
-	Streams:  []grpc.StreamDesc{},
-	Metadata: "allspark.proto",
-}
-
-func init() { proto.RegisterFile("allspark.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 118 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4b, 0xcc, 0xc9, 0x29,
-	0x2e, 0x48, 0x2c, 0xca, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0xe2, 0xe0, 0x62, 0x2b, 0x48,
-	0x2c, 0x4a, 0xcc, 0x2d, 0x56, 0x52, 0xe4, 0x62, 0xce, 0x2d, 0x4e, 0x17, 0x92, 0xe2, 0xe2, 0x28,
-	0x4a, 0x2d, 0x2e, 0xc8, 0xcf, 0x2b, 0x4e, 0x95, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0c, 0x82, 0xf3,
-	0x8d, 0x54, 0xb9, 0x38, 0x60, 0xda, 0x85, 0x24, 0xb9, 0x38, 0x3c, 0xf3, 0x92, 0xf3, 0x73, 0x33,
-	0xf3, 0xd2, 0x85, 0xd8, 0xf5, 0x20, 0x66, 0x48, 0xb1, 0xe8, 0xe5, 0x16, 0xa7, 0x3b, 0xb1, 0x44,
-	0x31, 0x15, 0x24, 0x25, 0xb1, 0x81, 0x2d, 0x30, 0x06, 0x04, 0x00, 0x00, 0xff, 0xff, 0x4f, 0x54,
-	0x54, 0xb7, 0x72, 0x00, 0x00, 0x00,
+		GoTypes:           file_allspark_proto_goTypes,
+		DependencyIndexes: file_allspark_proto_depIdxs,
+		MessageInfos:      file_allspark_proto_msgTypes,
+	}.Build()
+	File_allspark_proto = out.File
+	file_allspark_proto_rawDesc = nil
+	file_allspark_proto_goTypes = nil
+	file_allspark_proto_depIdxs = nil
 }
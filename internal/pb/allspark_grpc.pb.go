@@ -0,0 +1,313 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: allspark.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// AllsparkClient is the client API for Allspark service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AllsparkClient interface {
+	Incoming(ctx context.Context, in *Params, opts ...grpc.CallOption) (*Msg, error)
+	// ServerStream responds with hints.message_count messages
+	ServerStream(ctx context.Context, in *Params, opts ...grpc.CallOption) (Allspark_ServerStreamClient, error)
+	// ClientStream responds once the client closed the stream
+	ClientStream(ctx context.Context, opts ...grpc.CallOption) (Allspark_ClientStreamClient, error)
+	// BidiStream responds to every incoming message
+	BidiStream(ctx context.Context, opts ...grpc.CallOption) (Allspark_BidiStreamClient, error)
+}
+
+type allsparkClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAllsparkClient(cc grpc.ClientConnInterface) AllsparkClient {
+	return &allsparkClient{cc}
+}
+
+func (c *allsparkClient) Incoming(ctx context.Context, in *Params, opts ...grpc.CallOption) (*Msg, error) {
+	out := new(Msg)
+	err := c.cc.Invoke(ctx, "/allspark/Incoming", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *allsparkClient) ServerStream(ctx context.Context, in *Params, opts ...grpc.CallOption) (Allspark_ServerStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Allspark_ServiceDesc.Streams[0], "/allspark/ServerStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &allsparkServerStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Allspark_ServerStreamClient interface {
+	Recv() (*Msg, error)
+	grpc.ClientStream
+}
+
+type allsparkServerStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *allsparkServerStreamClient) Recv() (*Msg, error) {
+	m := new(Msg)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *allsparkClient) ClientStream(ctx context.Context, opts ...grpc.CallOption) (Allspark_ClientStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Allspark_ServiceDesc.Streams[1], "/allspark/ClientStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &allsparkClientStreamClient{stream}
+	return x, nil
+}
+
+type Allspark_ClientStreamClient interface {
+	Send(*Params) error
+	CloseAndRecv() (*Msg, error)
+	grpc.ClientStream
+}
+
+type allsparkClientStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *allsparkClientStreamClient) Send(m *Params) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *allsparkClientStreamClient) CloseAndRecv() (*Msg, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Msg)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *allsparkClient) BidiStream(ctx context.Context, opts ...grpc.CallOption) (Allspark_BidiStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Allspark_ServiceDesc.Streams[2], "/allspark/BidiStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &allsparkBidiStreamClient{stream}
+	return x, nil
+}
+
+type Allspark_BidiStreamClient interface {
+	Send(*Params) error
+	Recv() (*Msg, error)
+	grpc.ClientStream
+}
+
+type allsparkBidiStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *allsparkBidiStreamClient) Send(m *Params) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *allsparkBidiStreamClient) Recv() (*Msg, error) {
+	m := new(Msg)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AllsparkServer is the server API for Allspark service.
+// All implementations must embed UnimplementedAllsparkServer
+// for forward compatibility
+type AllsparkServer interface {
+	Incoming(context.Context, *Params) (*Msg, error)
+	// ServerStream responds with hints.message_count messages
+	ServerStream(*Params, Allspark_ServerStreamServer) error
+	// ClientStream responds once the client closed the stream
+	ClientStream(Allspark_ClientStreamServer) error
+	// BidiStream responds to every incoming message
+	BidiStream(Allspark_BidiStreamServer) error
+	mustEmbedUnimplementedAllsparkServer()
+}
+
+// UnimplementedAllsparkServer must be embedded to have forward compatible implementations.
+type UnimplementedAllsparkServer struct {
+}
+
+func (UnimplementedAllsparkServer) Incoming(context.Context, *Params) (*Msg, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Incoming not implemented")
+}
+func (UnimplementedAllsparkServer) ServerStream(*Params, Allspark_ServerStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ServerStream not implemented")
+}
+func (UnimplementedAllsparkServer) ClientStream(Allspark_ClientStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ClientStream not implemented")
+}
+func (UnimplementedAllsparkServer) BidiStream(Allspark_BidiStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method BidiStream not implemented")
+}
+func (UnimplementedAllsparkServer) mustEmbedUnimplementedAllsparkServer() {}
+
+// UnsafeAllsparkServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AllsparkServer will
+// result in compilation errors.
+type UnsafeAllsparkServer interface {
+	mustEmbedUnimplementedAllsparkServer()
+}
+
+func RegisterAllsparkServer(s grpc.ServiceRegistrar, srv AllsparkServer) {
+	s.RegisterService(&Allspark_ServiceDesc, srv)
+}
+
+func _Allspark_Incoming_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Params)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AllsparkServer).Incoming(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/allspark/Incoming",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AllsparkServer).Incoming(ctx, req.(*Params))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Allspark_ServerStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Params)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AllsparkServer).ServerStream(m, &allsparkServerStreamServer{stream})
+}
+
+type Allspark_ServerStreamServer interface {
+	Send(*Msg) error
+	grpc.ServerStream
+}
+
+type allsparkServerStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *allsparkServerStreamServer) Send(m *Msg) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Allspark_ClientStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AllsparkServer).ClientStream(&allsparkClientStreamServer{stream})
+}
+
+type Allspark_ClientStreamServer interface {
+	SendAndClose(*Msg) error
+	Recv() (*Params, error)
+	grpc.ServerStream
+}
+
+type allsparkClientStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *allsparkClientStreamServer) SendAndClose(m *Msg) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *allsparkClientStreamServer) Recv() (*Params, error) {
+	m := new(Params)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Allspark_BidiStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AllsparkServer).BidiStream(&allsparkBidiStreamServer{stream})
+}
+
+type Allspark_BidiStreamServer interface {
+	Send(*Msg) error
+	Recv() (*Params, error)
+	grpc.ServerStream
+}
+
+type allsparkBidiStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *allsparkBidiStreamServer) Send(m *Msg) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *allsparkBidiStreamServer) Recv() (*Params, error) {
+	m := new(Params)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Allspark_ServiceDesc is the grpc.ServiceDesc for Allspark service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Allspark_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "allspark",
+	HandlerType: (*AllsparkServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Incoming",
+			Handler:    _Allspark_Incoming_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ServerStream",
+			Handler:       _Allspark_ServerStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ClientStream",
+			Handler:       _Allspark_ClientStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "BidiStream",
+			Handler:       _Allspark_BidiStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "allspark.proto",
+}
@@ -0,0 +1,78 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Check reports an error when a dependency is not available
+type Check func(ctx context.Context) error
+
+// HTTPCheck returns a check which expects the URL to respond with a non-error status code
+func HTTPCheck(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return errors.WrapIf(err, "could not create request")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return errors.WrapIf(err, "request failed")
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return emperror.With(errors.New("unexpected status code"), "statusCode", resp.StatusCode)
+		}
+
+		return nil
+	}
+}
+
+// GRPCCheck returns a check which expects the GRPC server to be reachable and,
+// if it implements the standard health checking protocol, to be serving
+func GRPCCheck(address string) Check {
+	return func(ctx context.Context) error {
+		conn, err := grpc.DialContext(ctx, address, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return errors.WrapIf(err, "could not connect")
+		}
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		if err != nil {
+			return errors.WrapIf(err, "health check failed")
+		}
+
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return emperror.With(errors.New("not serving"), "status", resp.GetStatus().String())
+		}
+
+		return nil
+	}
+}
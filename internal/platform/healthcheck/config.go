@@ -14,9 +14,43 @@
 
 package healthcheck
 
+import (
+	"time"
+
+	"emperror.dev/errors"
+)
+
 type Config struct {
 	ListenAddress string `mapstructure:"listenAddress"`
 	Endpoint      string `mapstructure:"endpoint"`
+
+	LivenessEndpoint  string `mapstructure:"livenessEndpoint"`
+	ReadinessEndpoint string `mapstructure:"readinessEndpoint"`
+	StartupEndpoint   string `mapstructure:"startupEndpoint"`
+
+	// WarmupDelay is the time after start while the startup and readiness probes fail
+	WarmupDelay time.Duration `mapstructure:"warmupDelay"`
+
+	// CheckTimeout is the deadline for a single dependency check
+	CheckTimeout time.Duration `mapstructure:"checkTimeout"`
+
+	// Checks are the dependencies the readiness probe depends on
+	Checks ChecksConfig `mapstructure:"checks"`
+}
+
+// ChecksConfig holds the dependencies to check for readiness
+type ChecksConfig struct {
+	// SQL pings the configured SQL database
+	SQL bool `mapstructure:"sql"`
+
+	// Kafka holds the addresses of Kafka brokers that must be reachable
+	Kafka []string `mapstructure:"kafka"`
+
+	// HTTP holds URLs that must respond with a non-error status code
+	HTTP []string `mapstructure:"http"`
+
+	// GRPC holds the addresses of GRPC servers that must be serving
+	GRPC []string `mapstructure:"grpc"`
 }
 
 // Validate checks that the configuration is valid.
@@ -29,5 +63,43 @@ func (c Config) Validate() (Config, error) {
 		c.Endpoint = "/healthz"
 	}
 
+	if c.LivenessEndpoint == "" {
+		c.LivenessEndpoint = "/livez"
+	}
+
+	if c.ReadinessEndpoint == "" {
+		c.ReadinessEndpoint = "/readyz"
+	}
+
+	if c.StartupEndpoint == "" {
+		c.StartupEndpoint = "/startupz"
+	}
+
+	// the router panics on duplicate routes, so colliding endpoints are reported here
+	keys := make(map[string]string)
+	for _, e := range []struct{ key, endpoint string }{
+		{"endpoint", c.Endpoint},
+		{"livenessEndpoint", c.LivenessEndpoint},
+		{"readinessEndpoint", c.ReadinessEndpoint},
+		{"startupEndpoint", c.StartupEndpoint},
+	} {
+		if key, ok := keys[e.endpoint]; ok {
+			return c, errors.Errorf("%s and %s must differ: both are '%s'", key, e.key, e.endpoint)
+		}
+		keys[e.endpoint] = e.key
+	}
+
+	if c.WarmupDelay < 0 {
+		return c, errors.New("warm-up delay must not be negative")
+	}
+
+	if c.CheckTimeout < 0 {
+		return c, errors.New("check timeout must not be negative")
+	}
+
+	if c.CheckTimeout == 0 {
+		c.CheckTimeout = time.Second
+	}
+
 	return c, nil
 }
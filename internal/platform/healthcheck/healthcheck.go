@@ -15,24 +15,248 @@
 package healthcheck
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"emperror.dev/emperror"
+	"emperror.dev/errors"
 	"github.com/gin-gonic/gin"
 
 	"github.com/banzaicloud/allspark/internal/platform/log"
 )
 
-// New runs the health check endpoint
-func New(config Config, logger log.Logger, errorHandler emperror.Handler) {
-	logger.WithFields(log.Fields{"address": config.ListenAddress, "endpoint": config.Endpoint}).Info("starting HEALTHCHECK server")
+type Server struct {
+	listenAddress     string
+	endpoint          string
+	livenessEndpoint  string
+	readinessEndpoint string
+	startupEndpoint   string
+
+	warmupDelay  time.Duration
+	checkTimeout time.Duration
+
+	ready     int32
+	live      int32
+	startedAt time.Time
+
+	mu     sync.RWMutex
+	checks map[string]Check
+	routes []func(r gin.IRouter)
+
+	server *http.Server
+
+	errorHandler emperror.Handler
+	logger       log.Logger
+}
+
+// New creates the health check server
+func New(config Config, logger log.Logger, errorHandler emperror.Handler) *Server {
+	s := &Server{
+		listenAddress:     config.ListenAddress,
+		endpoint:          config.Endpoint,
+		livenessEndpoint:  config.LivenessEndpoint,
+		readinessEndpoint: config.ReadinessEndpoint,
+		startupEndpoint:   config.StartupEndpoint,
+
+		warmupDelay:  config.WarmupDelay,
+		checkTimeout: config.CheckTimeout,
+
+		ready:     1,
+		live:      1,
+		startedAt: time.Now(),
+
+		checks: make(map[string]Check),
+
+		server: &http.Server{
+			Addr: config.ListenAddress,
+		},
+
+		errorHandler: errorHandler,
+		logger:       logger,
+	}
+
+	for _, url := range config.Checks.HTTP {
+		s.AddReadinessCheck("http:"+url, HTTPCheck(url))
+	}
+	for _, address := range config.Checks.GRPC {
+		s.AddReadinessCheck("grpc:"+address, GRPCCheck(address))
+	}
+
+	return s
+}
+
+// AddReadinessCheck registers a dependency check the readiness probe depends on
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger.WithField("check", name).Info("readiness check added")
+	s.checks[name] = check
+}
+
+// SetReady sets whether the health check endpoint should report the service as ready
+func (s *Server) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+	s.logger.WithField("ready", ready).Info("readiness changed")
+}
+
+// IsReady returns whether the service is reported as ready
+func (s *Server) IsReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// SetLive sets whether the liveness probe should report the service as alive
+func (s *Server) SetLive(live bool) {
+	var v int32
+	if live {
+		v = 1
+	}
+	atomic.StoreInt32(&s.live, v)
+	s.logger.WithField("live", live).Info("liveness changed")
+}
+
+// IsLive returns whether the service is reported as alive
+func (s *Server) IsLive() bool {
+	return atomic.LoadInt32(&s.live) == 1
+}
+
+// AddRoutes registers additional routes on the health check server, it must be called before Run
+func (s *Server) AddRoutes(register func(r gin.IRouter)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes = append(s.routes, register)
+}
+
+// IsStarted returns whether the warm-up delay has elapsed
+func (s *Server) IsStarted() bool {
+	return time.Since(s.startedAt) >= s.warmupDelay
+}
+
+// Readiness runs the readiness checks and returns the failed ones
+func (s *Server) Readiness(ctx context.Context) map[string]error {
+	failed := make(map[string]error)
+
+	if !s.IsStarted() {
+		failed["startup"] = errors.New("warming up")
+	}
+
+	if !s.IsReady() {
+		failed["ready"] = errors.New("not ready")
+	}
+
+	s.mu.RLock()
+	checks := make(map[string]Check, len(s.checks))
+	for name, check := range s.checks {
+		checks[name] = check
+	}
+	s.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, s.checkTimeout)
+			defer cancel()
+
+			if err := check(ctx); err != nil {
+				mu.Lock()
+				failed[name] = err
+				mu.Unlock()
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return failed
+}
+
+// CheckReadiness runs the readiness checks and returns an error if any of them fails
+func (s *Server) CheckReadiness(ctx context.Context) error {
+	failed := s.Readiness(ctx)
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for name, err := range failed {
+		errs = append(errs, errors.WrapIf(err, name))
+	}
+
+	return errors.Combine(errs...)
+}
+
+// Run runs the health check endpoints
+func (s *Server) Run() {
+	s.logger.WithFields(log.Fields{
+		"address":           s.listenAddress,
+		"endpoint":          s.endpoint,
+		"livenessEndpoint":  s.livenessEndpoint,
+		"readinessEndpoint": s.readinessEndpoint,
+		"startupEndpoint":   s.startupEndpoint,
+	}).Info("starting HEALTHCHECK server")
 
 	r := gin.New()
-	r.GET(config.Endpoint, func(c *gin.Context) {
+	r.GET(s.endpoint, func(c *gin.Context) {
+		if !s.IsReady() {
+			c.String(http.StatusServiceUnavailable, "not ready")
+			return
+		}
 		c.String(http.StatusOK, "ok")
 	})
-	err := r.Run(config.ListenAddress)
-	if err != nil {
-		errorHandler.Handle(err)
+	r.GET(s.livenessEndpoint, func(c *gin.Context) {
+		if !s.IsLive() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not live"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET(s.startupEndpoint, func(c *gin.Context) {
+		if !s.IsStarted() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "warming up"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET(s.readinessEndpoint, func(c *gin.Context) {
+		failed := s.Readiness(c.Request.Context())
+		if len(failed) > 0 {
+			checks := make(map[string]string, len(failed))
+			for name, err := range failed {
+				checks[name] = err.Error()
+			}
+			s.logger.WithField("checks", checks).Warn("readiness check failed")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "failed": checks})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	s.mu.RLock()
+	for _, register := range s.routes {
+		register(r)
+	}
+	s.mu.RUnlock()
+	s.server.Handler = r
+
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.errorHandler.Handle(err)
 	}
 }
+
+// Shutdown gracefully stops the health check server
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down HEALTHCHECK server")
+
+	return s.server.Shutdown(ctx)
+}
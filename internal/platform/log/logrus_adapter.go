@@ -15,6 +15,7 @@
 package log
 
 import (
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -67,3 +68,15 @@ func NewLogrusLogger(config Config) Logger {
 		logrus.NewEntry(logger),
 	}
 }
+
+// NewNopLogger creates a logger which discards every message
+func NewNopLogger() Logger {
+	logger := logrus.New()
+
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.PanicLevel)
+
+	return &logrusAdapter{
+		logrus.NewEntry(logger),
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+)
+
+// maxAssertedBodySize is the size of the response body read for the body assertions
+const maxAssertedBodySize = 10 * 1024 * 1024
+
+// AssertionError is returned when a response does not meet an assertion of the request
+type AssertionError struct {
+	// Assertion is the name of the failed assertion, e.g. expectStatus
+	Assertion string
+	Message   string
+}
+
+func (e AssertionError) Error() string {
+	return fmt.Sprintf("assertion %s failed: %s", e.Assertion, e.Message)
+}
+
+// Assertions are the expectations on the response of a request
+type Assertions struct {
+	// StatusCodes are the accepted status code ranges, any status code below
+	// 400 is accepted if not set
+	StatusCodes []StatusCodeRange
+	// Headers are the response headers that must be present, with the given
+	// value if not empty
+	Headers map[string]string
+	// BodyContains are substrings the response body must contain
+	BodyContains []string
+	// BodyMatches are regular expressions the response body must match
+	BodyMatches []*regexp.Regexp
+	// JSON are values the JSON response body must hold
+	JSON []JSONAssertion
+	// MaxLatency is the maximum duration of the request, including reading the body
+	MaxLatency time.Duration
+}
+
+type StatusCodeRange struct {
+	From int
+	To   int
+}
+
+// JSONAssertion requires the value at the dot separated path of a JSON
+// document to exist, and to equal Value if set
+type JSONAssertion struct {
+	Path  string
+	Value *string
+}
+
+// parseAssertions creates the assertions from the options of the request definition
+func parseAssertions(options url.Values) (Assertions, error) {
+	var assertions Assertions
+
+	for _, option := range options["expectStatus"] {
+		for _, spec := range strings.Split(option, ",") {
+			from, to, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+			if !isRange {
+				to = from
+			}
+			r := StatusCodeRange{}
+			var err error
+			if r.From, err = strconv.Atoi(from); err != nil {
+				return assertions, emperror.With(errors.WrapIf(err, "invalid status code"), "expectStatus", option)
+			}
+			if r.To, err = strconv.Atoi(to); err != nil {
+				return assertions, emperror.With(errors.WrapIf(err, "invalid status code"), "expectStatus", option)
+			}
+			if r.From > r.To {
+				return assertions, emperror.With(errors.New("invalid status code range"), "expectStatus", option)
+			}
+			assertions.StatusCodes = append(assertions.StatusCodes, r)
+		}
+	}
+
+	for _, header := range options["expectHeader"] {
+		if assertions.Headers == nil {
+			assertions.Headers = make(map[string]string)
+		}
+		name, value, _ := strings.Cut(header, ":")
+		assertions.Headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	assertions.BodyContains = options["expectBody"]
+
+	for _, expr := range options["expectBodyRegex"] {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return assertions, emperror.With(errors.WrapIf(err, "invalid regular expression"), "expectBodyRegex", expr)
+		}
+		assertions.BodyMatches = append(assertions.BodyMatches, re)
+	}
+
+	for _, spec := range options["expectJSON"] {
+		path, value, hasValue := strings.Cut(spec, ":")
+		if path == "" {
+			return assertions, emperror.With(errors.New("JSON path is empty"), "expectJSON", spec)
+		}
+		assertion := JSONAssertion{Path: path}
+		if hasValue {
+			assertion.Value = &value
+		}
+		assertions.JSON = append(assertions.JSON, assertion)
+	}
+
+	if v := options.Get("maxLatency"); v != "" {
+		var err error
+		if assertions.MaxLatency, err = time.ParseDuration(v); err != nil {
+			return assertions, errors.WrapIf(err, "invalid maxLatency")
+		}
+	}
+
+	return assertions, nil
+}
+
+func (a Assertions) empty() bool {
+	return len(a.StatusCodes) == 0 && len(a.Headers) == 0 && !a.needsBody() && a.MaxLatency == 0
+}
+
+// needsBody returns whether the response body is needed to check the assertions
+func (a Assertions) needsBody() bool {
+	return len(a.BodyContains) > 0 || len(a.BodyMatches) > 0 || len(a.JSON) > 0
+}
+
+// bodyAssertion returns the name of the first body assertion
+func (a Assertions) bodyAssertion() string {
+	switch {
+	case len(a.BodyContains) > 0:
+		return "expectBody"
+	case len(a.BodyMatches) > 0:
+		return "expectBodyRegex"
+	default:
+		return "expectJSON"
+	}
+}
+
+// hasAssertionOptions returns whether any assertion is set in the options of the request definition
+func hasAssertionOptions(options url.Values) bool {
+	for name := range options {
+		if strings.HasPrefix(name, "expect") || name == "maxLatency" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check returns an AssertionError for the first assertion the response does not meet
+func (a Assertions) check(response *http.Response, body []byte, latency time.Duration) error {
+	if len(a.StatusCodes) > 0 {
+		accepted := false
+		for _, r := range a.StatusCodes {
+			if response.StatusCode >= r.From && response.StatusCode <= r.To {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return AssertionError{Assertion: "expectStatus", Message: fmt.Sprintf("unexpected status code %d", response.StatusCode)}
+		}
+	}
+
+	for name, value := range a.Headers {
+		values := response.Header.Values(name)
+		if len(values) == 0 {
+			return AssertionError{Assertion: "expectHeader", Message: fmt.Sprintf("header %s is missing", name)}
+		}
+		if value != "" && !contains(values, value) {
+			return AssertionError{Assertion: "expectHeader", Message: fmt.Sprintf("header %s is %q instead of %q", name, strings.Join(values, ", "), value)}
+		}
+	}
+
+	// the body is read up to one byte over the limit to detect the truncated bodies
+	if a.needsBody() && len(body) > maxAssertedBodySize {
+		return AssertionError{Assertion: a.bodyAssertion(), Message: fmt.Sprintf("body is larger than %d bytes", maxAssertedBodySize)}
+	}
+
+	for _, s := range a.BodyContains {
+		if !bytes.Contains(body, []byte(s)) {
+			return AssertionError{Assertion: "expectBody", Message: fmt.Sprintf("body does not contain %q", s)}
+		}
+	}
+
+	for _, re := range a.BodyMatches {
+		if !re.Match(body) {
+			return AssertionError{Assertion: "expectBodyRegex", Message: fmt.Sprintf("body does not match %q", re.String())}
+		}
+	}
+
+	if len(a.JSON) > 0 {
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return AssertionError{Assertion: "expectJSON", Message: "body is not a JSON document"}
+		}
+		for _, assertion := range a.JSON {
+			if err := assertion.check(document); err != nil {
+				return err
+			}
+		}
+	}
+
+	if a.MaxLatency > 0 && latency > a.MaxLatency {
+		return AssertionError{Assertion: "maxLatency", Message: fmt.Sprintf("latency exceeds %s", a.MaxLatency)}
+	}
+
+	return nil
+}
+
+func (a JSONAssertion) check(document interface{}) error {
+	value := document
+	for _, key := range strings.Split(a.Path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return AssertionError{Assertion: "expectJSON", Message: fmt.Sprintf("path %s does not exist", a.Path)}
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return AssertionError{Assertion: "expectJSON", Message: fmt.Sprintf("path %s does not exist", a.Path)}
+			}
+			value = v[i]
+		default:
+			return AssertionError{Assertion: "expectJSON", Message: fmt.Sprintf("path %s does not exist", a.Path)}
+		}
+	}
+
+	if a.Value == nil {
+		return nil
+	}
+
+	// strings are compared as they are, other values by their JSON encoding
+	actual, ok := value.(string)
+	if !ok {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return AssertionError{Assertion: "expectJSON", Message: err.Error()}
+		}
+		actual = string(encoded)
+	}
+	if actual != *a.Value {
+		return AssertionError{Assertion: "expectJSON", Message: fmt.Sprintf("value at %s is %s instead of %s", a.Path, actual, *a.Value)}
+	}
+
+	return nil
+}
@@ -0,0 +1,495 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const (
+	// BalancerRoundRobin sends the requests to the endpoints in turn
+	BalancerRoundRobin = "round-robin"
+	// BalancerRandom sends the requests to random endpoints
+	BalancerRandom = "random"
+	// BalancerLeastRequests sends the requests to the endpoint with the fewest in-flight requests
+	BalancerLeastRequests = "least-requests"
+	// BalancerHash sends the requests with the same incoming header value to the same endpoint
+	BalancerHash = "hash"
+
+	// ResolverDNS resolves the endpoints from the A/AAAA records of the host
+	ResolverDNS = "dns"
+	// ResolverSRV resolves the endpoints from the SRV records of the host
+	ResolverSRV = "srv"
+
+	hashRingReplicas = 100
+	resolveTimeout   = 5 * time.Second
+)
+
+// BalancerConfig holds the settings of the client-side load balancing
+type BalancerConfig struct {
+	// Endpoints are the host:port addresses the requests are sent to instead of the host of the URL
+	Endpoints []string
+	// Resolver resolves the endpoints from the host of the URL
+	// Accepted values are: dns, srv
+	Resolver string
+	// ResolveInterval is how long the resolved endpoints are used, defaults to 30s
+	ResolveInterval time.Duration
+	// Policy is the load balancing policy, defaults to round-robin
+	// Accepted values are: round-robin, random, least-requests, hash
+	Policy string
+	// HashHeader is the incoming request header the hash policy uses
+	HashHeader string
+}
+
+// parseBalancerConfig creates the load balancing settings from the options of the request definition
+func parseBalancerConfig(options url.Values) (BalancerConfig, error) {
+	config := BalancerConfig{
+		Resolver:        options.Get("resolver"),
+		ResolveInterval: 30 * time.Second,
+		Policy:          options.Get("balancer"),
+		HashHeader:      options.Get("hashHeader"),
+	}
+
+	for _, option := range options["endpoints"] {
+		for _, endpoint := range strings.Split(option, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				config.Endpoints = append(config.Endpoints, endpoint)
+			}
+		}
+	}
+
+	switch config.Resolver {
+	case "", ResolverDNS, ResolverSRV:
+	default:
+		return config, emperror.With(errors.New("invalid resolver"), "resolver", config.Resolver)
+	}
+	if config.Resolver != "" && len(config.Endpoints) > 0 {
+		return config, errors.New("endpoints and resolver are mutually exclusive")
+	}
+
+	if v := options.Get("resolveInterval"); v != "" {
+		var err error
+		if config.ResolveInterval, err = time.ParseDuration(v); err != nil {
+			return config, errors.WrapIf(err, "invalid resolveInterval")
+		}
+	}
+
+	switch config.Policy {
+	case "":
+		config.Policy = BalancerRoundRobin
+	case BalancerRoundRobin, BalancerRandom, BalancerLeastRequests:
+	case BalancerHash:
+		if config.HashHeader == "" {
+			return config, errors.New("hash balancer requires hashHeader")
+		}
+	default:
+		return config, emperror.With(errors.New("invalid balancer"), "balancer", config.Policy)
+	}
+
+	if !config.Enabled() && (options.Get("balancer") != "" || options.Get("resolveInterval") != "") {
+		return config, errors.New("load balancing requires endpoints or resolver")
+	}
+
+	return config, nil
+}
+
+// Enabled returns whether the requests are load balanced
+func (c BalancerConfig) Enabled() bool {
+	return len(c.Endpoints) > 0 || c.Resolver != ""
+}
+
+// endpointFactory creates the request of an endpoint from the request definition
+type endpointFactory func(request HTTPRequest) (Request, error)
+
+// balancedRequest is a request sent to one of the endpoints of the balancer
+type balancedRequest struct {
+	*balancer
+}
+
+type balancer struct {
+	config     BalancerConfig
+	definition HTTPRequest
+	// host is the host of the URL replaced by the endpoints
+	host   string
+	create endpointFactory
+	// count is the count of the requests created by the factory, e.g. 1 for TCP requests without a size
+	count uint
+
+	// resolveMu is held during the resolution, so the endpoints are only resolved by one request at a time
+	resolveMu sync.Mutex
+
+	mu         sync.Mutex
+	endpoints  []string
+	resolvedAt time.Time
+	requests   map[string]Request
+	inFlight   map[string]int
+	next       int
+	ring       []ringNode
+}
+
+type ringNode struct {
+	hash     uint32
+	endpoint string
+}
+
+func newBalancedRequest(request HTTPRequest, config BalancerConfig, create endpointFactory) (Request, error) {
+	sampleURL, err := renderSample(request.URL)
+	if err != nil {
+		return nil, emperror.With(err, "url", request.URL)
+	}
+	u, err := url.Parse(sampleURL)
+	if err != nil {
+		return nil, emperror.With(errors.WrapIf(err, "invalid URL"), "url", request.URL)
+	}
+	if strings.HasPrefix(u.Scheme, "kafka-") {
+		return nil, emperror.With(errors.New("kafka requests can not be load balanced"), "url", request.URL)
+	}
+	if !strings.Contains(request.URL, "://"+u.Host) {
+		return nil, emperror.With(errors.New("host can not be a template when load balancing"), "url", request.URL)
+	}
+
+	// the requests of the endpoints share the counters of the definition
+	request.counter = &counter{}
+	request.assertionFailures = &counter{}
+
+	b := &balancer{
+		config:     config,
+		definition: request,
+		host:       u.Host,
+		create:     create,
+		requests:   make(map[string]Request),
+		inFlight:   make(map[string]int),
+	}
+
+	// the request of the URL validates the definition
+	req, err := create(request)
+	if err != nil {
+		return nil, err
+	}
+	b.count = req.Count()
+
+	if len(config.Endpoints) > 0 {
+		b.setEndpoints(config.Endpoints)
+		for _, endpoint := range b.endpoints {
+			req, err := b.newRequest(endpoint)
+			if err != nil {
+				return nil, err
+			}
+			b.requests[endpoint] = req
+		}
+	}
+
+	return balancedRequest{b}, nil
+}
+
+func (r balancedRequest) Count() uint {
+	return r.count
+}
+
+func (r balancedRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	return r.doIncoming(Incoming{Headers: incomingRequestHeaders}, logger)
+}
+
+func (r balancedRequest) doIncoming(incoming Incoming, logger log.Logger) error {
+	endpoint, req, err := r.pick(incoming.Headers, logger)
+	if err != nil {
+		logger.WithField("url", r.definition.URL).Error(err.Error())
+		return err
+	}
+	defer r.closeIfRemoved(endpoint, req)
+	defer r.release(endpoint)
+
+	if request, ok := req.(incomingRequest); ok {
+		return request.doIncoming(incoming, logger)
+	}
+
+	return req.Do(incoming.Headers, logger)
+}
+
+// pick chooses an endpoint by the policy and returns its request
+func (b *balancer) pick(incomingRequestHeaders http.Header, logger log.Logger) (string, Request, error) {
+	b.resolve(logger)
+
+	endpoint, req, err := b.choose(incomingRequestHeaders)
+	if err != nil || req != nil {
+		return endpoint, req, err
+	}
+
+	// the request of a new endpoint is created without holding the lock
+	req, err = b.newRequest(endpoint)
+	if err != nil {
+		b.release(endpoint)
+		return "", nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.requests[endpoint]; ok {
+		return endpoint, existing, nil
+	}
+	// the endpoints may have been replaced in the meantime
+	if i := sort.SearchStrings(b.endpoints, endpoint); i < len(b.endpoints) && b.endpoints[i] == endpoint {
+		b.requests[endpoint] = req
+	}
+
+	return endpoint, req, nil
+}
+
+// choose chooses an endpoint by the policy and counts it in flight, it returns
+// the request of the endpoint if it is already created
+func (b *balancer) choose(incomingRequestHeaders http.Header) (string, Request, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.endpoints) == 0 {
+		return "", nil, emperror.With(errors.New("no endpoints to send the request to"), "host", b.host)
+	}
+
+	var endpoint string
+	switch b.config.Policy {
+	case BalancerRandom:
+		// nolint:gosec
+		endpoint = b.endpoints[rand.Intn(len(b.endpoints))]
+	case BalancerLeastRequests:
+		// ties are broken by starting at a random endpoint
+		// nolint:gosec
+		start := rand.Intn(len(b.endpoints))
+		for i := range b.endpoints {
+			e := b.endpoints[(start+i)%len(b.endpoints)]
+			if endpoint == "" || b.inFlight[e] < b.inFlight[endpoint] {
+				endpoint = e
+			}
+		}
+	case BalancerHash:
+		value := incomingRequestHeaders.Get(b.config.HashHeader)
+		if value == "" {
+			// nolint:gosec
+			endpoint = b.endpoints[rand.Intn(len(b.endpoints))]
+			break
+		}
+		h := hash(value)
+		i := sort.Search(len(b.ring), func(i int) bool { return b.ring[i].hash >= h })
+		endpoint = b.ring[i%len(b.ring)].endpoint
+	default:
+		endpoint = b.endpoints[b.next%len(b.endpoints)]
+		b.next++
+	}
+
+	b.inFlight[endpoint]++
+
+	return endpoint, b.requests[endpoint], nil
+}
+
+func (b *balancer) release(endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.inFlight[endpoint] > 0 {
+		b.inFlight[endpoint]--
+	}
+}
+
+// closeIfRemoved closes the idle connections of a request which is not the request of its
+// endpoint anymore, or never was, as every endpoint request has its own transport
+func (b *balancer) closeIfRemoved(endpoint string, req Request) {
+	rt := roundTripper(req)
+	if rt == nil {
+		return
+	}
+
+	b.mu.Lock()
+	current := roundTripper(b.requests[endpoint])
+	b.mu.Unlock()
+
+	if rt != current {
+		closeIdleConnections(rt)
+	}
+}
+
+// newRequest creates the request of the endpoint from the definition
+func (b *balancer) newRequest(endpoint string) (Request, error) {
+	definition := b.definition
+	definition.URL = strings.Replace(definition.URL, "://"+b.host, "://"+endpoint, 1)
+	req, err := b.create(definition)
+	if err != nil {
+		return nil, emperror.With(err, "endpoint", endpoint)
+	}
+
+	return req, nil
+}
+
+// resolveDue returns whether the resolve interval has elapsed, and whether there are endpoints to pick from
+func (b *balancer) resolveDue() (bool, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.config.Resolver != "" && time.Since(b.resolvedAt) >= b.config.ResolveInterval, len(b.endpoints) > 0
+}
+
+// resolve refreshes the endpoints when the resolve interval has elapsed, the
+// previous endpoints are kept if the resolution fails; the lookup does not
+// block the requests while there are endpoints to pick from
+func (b *balancer) resolve(logger log.Logger) {
+	due, ready := b.resolveDue()
+	if !due {
+		return
+	}
+	if ready {
+		if !b.resolveMu.TryLock() {
+			return
+		}
+	} else {
+		b.resolveMu.Lock()
+	}
+	defer b.resolveMu.Unlock()
+
+	// the endpoints may have been resolved while waiting
+	if due, _ = b.resolveDue(); !due {
+		return
+	}
+
+	endpoints, err := b.lookup()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.resolvedAt = time.Now()
+	if err != nil {
+		logger.WithFields(log.Fields{"host": b.host, "error": err.Error()}).Warn("could not resolve endpoints")
+		return
+	}
+	if b.setEndpoints(endpoints) {
+		logger.WithFields(log.Fields{
+			"host":      b.host,
+			"endpoints": strings.Join(b.endpoints, ","),
+		}).Info("endpoints resolved")
+	}
+}
+
+// lookup resolves the endpoints of the host with the configured resolver
+func (b *balancer) lookup() ([]string, error) {
+	hostname, port := b.host, ""
+	if h, p, err := net.SplitHostPort(b.host); err == nil {
+		hostname, port = h, p
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	var endpoints []string
+	switch b.config.Resolver {
+	case ResolverSRV:
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			endpoints = append(endpoints, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+	default:
+		addresses, err := net.DefaultResolver.LookupHost(ctx, hostname)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			switch {
+			case port != "":
+				endpoints = append(endpoints, net.JoinHostPort(address, port))
+			case strings.Contains(address, ":"):
+				endpoints = append(endpoints, "["+address+"]")
+			default:
+				endpoints = append(endpoints, address)
+			}
+		}
+	}
+
+	return endpoints, nil
+}
+
+// setEndpoints replaces the endpoints, returns whether they have changed
+func (b *balancer) setEndpoints(endpoints []string) bool {
+	endpoints = append([]string(nil), endpoints...)
+	sort.Strings(endpoints)
+
+	if strings.Join(endpoints, ",") == strings.Join(b.endpoints, ",") {
+		return false
+	}
+	b.endpoints = endpoints
+
+	current := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		current[endpoint] = true
+	}
+	for endpoint, req := range b.requests {
+		if !current[endpoint] {
+			// the in-flight requests close the rest when they are done
+			closeIdleConnections(roundTripper(req))
+			delete(b.requests, endpoint)
+		}
+	}
+
+	b.ring = b.ring[:0]
+	for _, endpoint := range endpoints {
+		for i := 0; i < hashRingReplicas; i++ {
+			b.ring = append(b.ring, ringNode{
+				hash:     hash(endpoint + "#" + strconv.Itoa(i)),
+				endpoint: endpoint,
+			})
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i].hash < b.ring[j].hash })
+
+	return true
+}
+
+// roundTripper returns the transport of an HTTP request, or nil for other requests
+func roundTripper(req Request) http.RoundTripper {
+	switch r := req.(type) {
+	case breakerRequest:
+		return roundTripper(r.Request)
+	case HTTPRequest:
+		return r.roundTripper
+	}
+
+	return nil
+}
+
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s)) // nolint:errcheck
+
+	return h.Sum32()
+}
@@ -0,0 +1,301 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+// ErrCircuitOpen is returned when a request is short-circuited by an open circuit breaker
+var ErrCircuitOpen = errors.NewPlain("circuit breaker is open")
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// BreakerConfig holds the settings of a circuit breaker
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures which open the circuit
+	Failures uint
+	// ErrorRate is the ratio of failures in the window which opens the circuit
+	ErrorRate float64
+	// Window is the number of the latest requests the error rate is calculated on, defaults to 20
+	Window uint
+	// OpenDuration is how long the circuit stays open before probing the target, defaults to 10s
+	OpenDuration time.Duration
+	// Probes is the number of successful requests in half-open state which close the circuit, defaults to 1
+	Probes uint
+}
+
+// parseBreakerConfig creates the circuit breaker settings from the options of the request definition
+func parseBreakerConfig(options url.Values) (BreakerConfig, error) {
+	config := BreakerConfig{
+		Window:       20,
+		OpenDuration: 10 * time.Second,
+		Probes:       1,
+	}
+
+	parseUint := func(name string, value *uint) error {
+		if v := options.Get(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return emperror.With(errors.WrapIf(err, "invalid circuit breaker option"), "option", name)
+			}
+			if n == 0 {
+				return emperror.With(errors.New("circuit breaker option must be positive"), "option", name)
+			}
+			*value = uint(n)
+		}
+		return nil
+	}
+
+	if err := parseUint("breakerFailures", &config.Failures); err != nil {
+		return config, err
+	}
+	if err := parseUint("breakerWindow", &config.Window); err != nil {
+		return config, err
+	}
+	if err := parseUint("breakerProbes", &config.Probes); err != nil {
+		return config, err
+	}
+
+	var err error
+	if v := options.Get("breakerErrorRate"); v != "" {
+		if config.ErrorRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return config, errors.WrapIf(err, "invalid breakerErrorRate")
+		}
+		if config.ErrorRate <= 0 || config.ErrorRate > 1 {
+			return config, emperror.With(errors.New("breakerErrorRate must be in the (0, 1] range"), "breakerErrorRate", v)
+		}
+	}
+
+	if v := options.Get("breakerOpenDuration"); v != "" {
+		if config.OpenDuration, err = time.ParseDuration(v); err != nil {
+			return config, errors.WrapIf(err, "invalid breakerOpenDuration")
+		}
+	}
+
+	return config, nil
+}
+
+// Enabled returns whether a circuit breaker is configured
+func (c BreakerConfig) Enabled() bool {
+	return c.Failures > 0 || c.ErrorRate > 0
+}
+
+// breaker is a circuit breaker of a target, shared by the requests sent to it
+type breaker struct {
+	config BreakerConfig
+	target string
+
+	mu       sync.Mutex
+	state    string
+	openedAt time.Time
+	// generation is incremented on every state change, so the outcomes of the
+	// requests allowed in a previous state are ignored
+	generation uint64
+	// consecutive is the number of consecutive failures
+	consecutive uint
+	// results are the outcomes of the latest requests in a ring buffer
+	results []bool
+	next    int
+	// probes are the in-flight and succeeded requests in half-open state
+	probes    uint
+	succeeded uint
+}
+
+func newBreaker(config BreakerConfig, target string) *breaker {
+	return &breaker{
+		config: config,
+		target: target,
+		state:  breakerClosed,
+	}
+}
+
+// allow returns whether a request can be sent, and the generation its outcome must be recorded with
+func (b *breaker) allow(logger log.Logger) (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.config.OpenDuration {
+			return 0, false
+		}
+		b.transition(breakerHalfOpen, logger)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.config.Probes {
+			return 0, false
+		}
+		b.probes++
+	}
+
+	return b.generation, true
+}
+
+// done records the outcome of an allowed request, unless the state changed since it was allowed
+func (b *breaker) done(generation uint64, success bool, logger log.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case breakerHalfOpen:
+		if !success {
+			b.transition(breakerOpen, logger)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.config.Probes {
+			b.transition(breakerClosed, logger)
+		}
+	case breakerClosed:
+		b.record(success)
+		if b.tripped() {
+			b.transition(breakerOpen, logger)
+		}
+	}
+}
+
+func (b *breaker) record(success bool) {
+	if success {
+		b.consecutive = 0
+	} else {
+		b.consecutive++
+	}
+
+	if b.config.ErrorRate == 0 {
+		return
+	}
+	if uint(len(b.results)) < b.config.Window {
+		b.results = append(b.results, success)
+		return
+	}
+	b.results[b.next] = success
+	b.next = (b.next + 1) % len(b.results)
+}
+
+// tripped returns whether the failures reached the thresholds
+func (b *breaker) tripped() bool {
+	if b.config.Failures > 0 && b.consecutive >= b.config.Failures {
+		return true
+	}
+
+	// the error rate is only calculated on a full window
+	if b.config.ErrorRate > 0 && uint(len(b.results)) >= b.config.Window {
+		var failures int
+		for _, success := range b.results {
+			if !success {
+				failures++
+			}
+		}
+		return float64(failures)/float64(len(b.results)) >= b.config.ErrorRate
+	}
+
+	return false
+}
+
+func (b *breaker) transition(state string, logger log.Logger) {
+	logger.WithFields(log.Fields{
+		"target": b.target,
+		"from":   b.state,
+		"to":     state,
+	}).Warn("circuit breaker state changed")
+
+	b.state = state
+	b.generation++
+	b.consecutive = 0
+	b.results = b.results[:0]
+	b.next = 0
+	b.probes = 0
+	b.succeeded = 0
+	if state == breakerOpen {
+		b.openedAt = time.Now()
+	}
+}
+
+// breakers holds the circuit breakers by target
+type breakers struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakers() *breakers {
+	return &breakers{
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// get returns the circuit breaker of the target, the requests of the same
+// target must use the same settings
+func (b *breakers) get(config BreakerConfig, target string) (*breaker, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.breakers[target]; ok {
+		if existing.config != config {
+			return nil, emperror.With(errors.New("conflicting circuit breaker settings"), "target", target)
+		}
+		return existing, nil
+	}
+
+	b.breakers[target] = newBreaker(config, target)
+
+	return b.breakers[target], nil
+}
+
+// breakerRequest is a request sent through the circuit breaker of its target
+type breakerRequest struct {
+	Request
+
+	breaker *breaker
+}
+
+func (r breakerRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	return r.doIncoming(Incoming{Headers: incomingRequestHeaders}, logger)
+}
+
+func (r breakerRequest) doIncoming(incoming Incoming, logger log.Logger) error {
+	generation, ok := r.breaker.allow(logger)
+	if !ok {
+		logger.WithField("target", r.breaker.target).Warn("request short-circuited")
+		return ErrCircuitOpen
+	}
+
+	var err error
+	if request, ok := r.Request.(incomingRequest); ok {
+		err = request.doIncoming(incoming, logger)
+	} else {
+		err = r.Request.Do(incoming.Headers, logger)
+	}
+	r.breaker.done(generation, err == nil, logger)
+
+	return err
+}
@@ -15,9 +15,16 @@
 package request
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"emperror.dev/errors"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 
@@ -25,19 +32,92 @@ import (
 	"github.com/banzaicloud/allspark/internal/platform/log"
 )
 
+const (
+	grpcServiceAllspark = "allspark"
+
+	grpcMethodServerStream = "ServerStream"
+	grpcMethodClientStream = "ClientStream"
+	grpcMethodBidiStream   = "BidiStream"
+)
+
 type GRPCRequest struct {
 	Host    string `json:"host"`
 	Service string `json:"service"`
 	Method  string `json:"method"`
 
-	count uint
+	// Messages is the number of messages sent or requested on streams
+	Messages uint `json:"messages"`
+	// PayloadSize is the size of the payload of every sent message in bytes
+	PayloadSize uint `json:"payloadSize"`
+	// ResponseSize is the size of the payload the server should respond with in bytes
+	ResponseSize uint `json:"responseSize"`
+	// Interval is the delay between the streamed messages
+	Interval time.Duration `json:"interval"`
+	// Echo asks the server to echo the payload back
+	Echo bool `json:"echo"`
+
+	// Body is the JSON representation of the request message of arbitrary services
+	Body string `json:"body"`
+	// DescriptorSet is the path of a FileDescriptorSet describing the service,
+	// server reflection is used when not set
+	DescriptorSet string `json:"descriptorSet"`
+
+	resolver *grpcMethodResolver
+	proxy    *proxyDialer
+	count    uint
+}
+
+// parseGRPCOptions sets the stream and payload options from the options of the request definition
+func (request *GRPCRequest) parseGRPCOptions(options url.Values) error {
+	var err error
+
+	if v := options.Get("messages"); v != "" {
+		var messages uint64
+		if messages, err = strconv.ParseUint(v, 10, 32); err != nil {
+			return errors.WrapIf(err, "invalid messages")
+		}
+		request.Messages = uint(messages)
+	}
+
+	if v := options.Get("size"); v != "" {
+		var size uint64
+		if size, err = strconv.ParseUint(v, 10, 32); err != nil {
+			return errors.WrapIf(err, "invalid size")
+		}
+		request.PayloadSize = uint(size)
+	}
+
+	if v := options.Get("responseSize"); v != "" {
+		var size uint64
+		if size, err = strconv.ParseUint(v, 10, 32); err != nil {
+			return errors.WrapIf(err, "invalid responseSize")
+		}
+		request.ResponseSize = uint(size)
+	}
+
+	if v := options.Get("interval"); v != "" {
+		if request.Interval, err = time.ParseDuration(v); err != nil {
+			return errors.WrapIf(err, "invalid interval")
+		}
+	}
+
+	request.Body = options.Get("body")
+	request.DescriptorSet = options.Get("descriptorSet")
+
+	if v := options.Get("echo"); v != "" {
+		if request.Echo, err = strconv.ParseBool(v); err != nil {
+			return errors.WrapIf(err, "invalid echo")
+		}
+	}
+
+	return nil
 }
 
 func (request GRPCRequest) Count() uint {
 	return request.count
 }
 
-func (request GRPCRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) {
+func (request GRPCRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
 	correlationID := uuid.New()
 	log := logger.WithFields(log.Fields{
 		"host":          request.Host,
@@ -49,18 +129,172 @@ func (request GRPCRequest) Do(incomingRequestHeaders http.Header, logger log.Log
 
 	ctx := propagateGRPCHeaders(context.Background(), incomingRequestHeaders)
 
-	conn, err := grpc.Dial(request.Host, grpc.WithInsecure())
+	options := []grpc.DialOption{grpc.WithInsecure()}
+	if request.proxy != nil {
+		options = append(options, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return request.proxy.dial(ctx, "https", addr)
+		}))
+	} else {
+		// without proxy settings the proxy of the environment variables is not used
+		options = append(options, grpc.WithNoProxy())
+	}
+
+	conn, err := grpc.Dial(request.Host, options...)
 	if err != nil {
 		log.Error(err.Error())
-		return
+		return err
 	}
 	defer conn.Close()
 
 	c := pb.NewAllsparkClient(conn)
-	_, err = c.Incoming(ctx, &pb.Params{})
+
+	start := time.Now()
+	var received uint
+	var response string
+	switch {
+	case !request.isAllspark():
+		received, response, err = request.invoke(ctx, conn)
+	case request.Method == grpcMethodServerStream:
+		received, err = request.serverStream(ctx, c)
+	case request.Method == grpcMethodClientStream:
+		received, err = request.clientStream(ctx, c)
+	case request.Method == grpcMethodBidiStream:
+		received, err = request.bidiStream(ctx, c)
+	default:
+		_, err = c.Incoming(ctx, request.params())
+		received = 1
+	}
 	if err != nil {
 		log.Error(err.Error())
-		return
+		return err
+	}
+	if response != "" {
+		log.WithField("response", response).Debug("response message")
+	}
+	log.WithField("messages", received).WithField("duration", time.Since(start)).Info("response to outgoing request")
+
+	return nil
+}
+
+// isAllspark returns whether the request targets the allspark service using
+// the compiled-in client, arbitrary services are invoked dynamically
+func (request GRPCRequest) isAllspark() bool {
+	return request.Service == grpcServiceAllspark && request.Body == "" && request.DescriptorSet == ""
+}
+
+func (request GRPCRequest) params() *pb.Params {
+	return &pb.Params{
+		Payload: bytes.Repeat([]byte("."), int(request.PayloadSize)),
+		Hints: &pb.Hints{
+			Echo:              request.Echo,
+			ResponseSize:      uint32(request.ResponseSize),
+			MessageCount:      uint32(request.Messages),
+			MessageIntervalMs: uint32(request.Interval / time.Millisecond),
+		},
+	}
+}
+
+func (request GRPCRequest) messages() uint {
+	if request.Messages == 0 {
+		return 1
+	}
+
+	return request.Messages
+}
+
+func (request GRPCRequest) serverStream(ctx context.Context, c pb.AllsparkClient) (uint, error) {
+	stream, err := c.ServerStream(ctx, request.params())
+	if err != nil {
+		return 0, errors.WrapIf(err, "could not open stream")
+	}
+
+	var received uint
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return received, nil
+		}
+		if err != nil {
+			return received, errors.WrapIf(err, "could not receive message")
+		}
+		received++
+	}
+}
+
+func (request GRPCRequest) clientStream(ctx context.Context, c pb.AllsparkClient) (uint, error) {
+	stream, err := c.ClientStream(ctx)
+	if err != nil {
+		return 0, errors.WrapIf(err, "could not open stream")
+	}
+
+	params := request.params()
+	for i := uint(0); i < request.messages(); i++ {
+		if i > 0 && request.Interval > 0 {
+			if err := sleep(ctx, request.Interval); err != nil {
+				return 0, err
+			}
+		}
+		if err := stream.Send(params); err != nil {
+			return 0, errors.WrapIf(err, "could not send message")
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return 0, errors.WrapIf(err, "could not receive response")
+	}
+
+	return 1, nil
+}
+
+func (request GRPCRequest) bidiStream(ctx context.Context, c pb.AllsparkClient) (uint, error) {
+	stream, err := c.BidiStream(ctx)
+	if err != nil {
+		return 0, errors.WrapIf(err, "could not open stream")
+	}
+
+	params := request.params()
+	var received uint
+	for i := uint(0); i < request.messages(); i++ {
+		if i > 0 && request.Interval > 0 {
+			if err := sleep(ctx, request.Interval); err != nil {
+				return received, err
+			}
+		}
+		if err := stream.Send(params); err != nil {
+			return received, errors.WrapIf(err, "could not send message")
+		}
+		if _, err := stream.Recv(); err != nil {
+			return received, errors.WrapIf(err, "could not receive message")
+		}
+		received++
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return received, errors.WrapIf(err, "could not close stream")
+	}
+
+	// the final status of the stream is received after the server has finished
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return received, nil
+		}
+		if err != nil {
+			return received, errors.WrapIf(err, "could not receive message")
+		}
+		received++
+	}
+}
+
+// sleep waits for the given duration, or returns the error of the context if it is done earlier
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.WrapIf(ctx.Err(), "stream interrupted")
+	case <-timer.C:
+		return nil
 	}
-	log.Info("response to outgoing request")
 }
@@ -0,0 +1,248 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// grpcMethodResolver resolves and caches the descriptor of the method a
+// GRPCRequest calls, either from a FileDescriptorSet file or through server reflection
+type grpcMethodResolver struct {
+	mu     sync.Mutex
+	method protoreflect.MethodDescriptor
+}
+
+func (r *grpcMethodResolver) resolve(ctx context.Context, conn *grpc.ClientConn, request GRPCRequest) (protoreflect.MethodDescriptor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.method != nil {
+		return r.method, nil
+	}
+
+	var files *protoregistry.Files
+	var err error
+	if request.DescriptorSet != "" {
+		files, err = filesFromDescriptorSet(request.DescriptorSet)
+	} else {
+		files, err = filesFromReflection(ctx, conn, request.Service)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(request.Service))
+	if err != nil {
+		return nil, emperror.With(errors.WrapIf(err, "could not find service"), "service", request.Service)
+	}
+	service, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, emperror.With(errors.New("not a service"), "service", request.Service)
+	}
+
+	method := service.Methods().ByName(protoreflect.Name(request.Method))
+	if method == nil {
+		return nil, emperror.With(errors.New("could not find method"), "service", request.Service, "method", request.Method)
+	}
+	r.method = method
+
+	return method, nil
+}
+
+func filesFromDescriptorSet(path string) (*protoregistry.Files, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not read descriptor set")
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, errors.WrapIf(err, "could not parse descriptor set")
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, errors.WrapIf(err, "invalid descriptor set")
+	}
+
+	return files, nil
+}
+
+func filesFromReflection(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not open reflection stream")
+	}
+	defer stream.CloseSend() // nolint:errcheck
+
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+	fetch := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return errors.WrapIf(err, "could not send reflection request")
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return errors.WrapIf(err, "could not receive reflection response")
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			return errors.Errorf("reflection error: %s", errResp.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var fd descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(b, &fd); err != nil {
+				return errors.WrapIf(err, "could not parse file descriptor")
+			}
+			protos[fd.GetName()] = &fd
+		}
+		return nil
+	}
+
+	err = fetch(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: service,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch the dependencies the server did not send along
+	for missing := missingDependencies(protos); len(missing) > 0; missing = missingDependencies(protos) {
+		for _, name := range missing {
+			err := fetch(&rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{
+					FileByFilename: name,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := protos[name]; !ok {
+				return nil, emperror.With(errors.New("dependency not found"), "file", name)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range protos {
+		set.File = append(set.File, fd)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, errors.WrapIf(err, "invalid file descriptors")
+	}
+
+	return files, nil
+}
+
+func missingDependencies(protos map[string]*descriptorpb.FileDescriptorProto) []string {
+	var missing []string
+	for _, fd := range protos {
+		for _, dep := range fd.GetDependency() {
+			if _, ok := protos[dep]; !ok {
+				missing = append(missing, dep)
+			}
+		}
+	}
+
+	return missing
+}
+
+// invoke calls the resolved method with the JSON body converted to protobuf
+// and returns the number of received messages and the last one as JSON
+func (request GRPCRequest) invoke(ctx context.Context, conn *grpc.ClientConn) (uint, string, error) {
+	method, err := request.resolver.resolve(ctx, conn, request)
+	if err != nil {
+		return 0, "", err
+	}
+
+	body := dynamicpb.NewMessage(method.Input())
+	if request.Body != "" {
+		if err := protojson.Unmarshal([]byte(request.Body), body); err != nil {
+			return 0, "", errors.WrapIf(err, "could not convert request body")
+		}
+	}
+
+	desc := &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ServerStreams: method.IsStreamingServer(),
+		ClientStreams: method.IsStreamingClient(),
+	}
+	fullMethod := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+
+	stream, err := conn.NewStream(ctx, desc, fullMethod)
+	if err != nil {
+		return 0, "", errors.WrapIf(err, "could not open stream")
+	}
+
+	messages := uint(1)
+	if method.IsStreamingClient() {
+		messages = request.messages()
+	}
+	for i := uint(0); i < messages; i++ {
+		if err := stream.SendMsg(body); err != nil {
+			return 0, "", errors.WrapIf(err, "could not send message")
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return 0, "", errors.WrapIf(err, "could not close stream")
+	}
+
+	var received uint
+	var last *dynamicpb.Message
+	for {
+		resp := dynamicpb.NewMessage(method.Output())
+		err := stream.RecvMsg(resp)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return received, "", errors.WrapIf(err, "could not receive message")
+		}
+		received++
+		last = resp
+		if !method.IsStreamingServer() {
+			break
+		}
+	}
+
+	var response string
+	if last != nil {
+		b, err := protojson.Marshal(last)
+		if err != nil {
+			return received, "", errors.WrapIf(err, "could not convert response")
+		}
+		response = string(b)
+	}
+
+	return received, response, nil
+}
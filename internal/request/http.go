@@ -15,54 +15,468 @@
 package request
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
 	"github.com/google/uuid"
+	"golang.org/x/net/http2"
 
 	"github.com/banzaicloud/allspark/internal/platform/log"
 )
 
+const (
+	// HTTPProtocolHTTP1 forces HTTP/1.1 even over TLS
+	HTTPProtocolHTTP1 = "http1"
+	// HTTPProtocolH2C uses HTTP/2 over cleartext with prior knowledge
+	HTTPProtocolH2C = "h2c"
+	// HTTPProtocolH2 forces HTTP/2 over TLS
+	HTTPProtocolH2 = "h2"
+
+	// httpDialTimeout matches the dial timeout of the default HTTP transport
+	httpDialTimeout = 30 * time.Second
+)
+
+// StatusCodeError is returned when the response status code is 400 or above
+type StatusCodeError struct {
+	Code int
+}
+
+func (e StatusCodeError) Error() string {
+	return fmt.Sprintf("unexpected response status code %d", e.Code)
+}
+
 type HTTPRequest struct {
 	URL string `json:"URL"`
 
-	count uint
+	// Method defaults to GET
+	Method string `json:"method"`
+	// Headers are set on the request in addition to the propagated ones
+	Headers map[string]string `json:"headers"`
+	// Body is sent as the request body if not empty
+	Body string `json:"body"`
+
+	// Protocol is one of http1, h2c or h2, the protocol is negotiated
+	// by the default HTTP client if not set
+	Protocol string `json:"protocol"`
+	// Insecure skips the verification of the server certificate
+	Insecure bool `json:"insecure"`
+	// CloseConnection opens a new connection for every HTTP/1 request instead of reusing them
+	CloseConnection bool `json:"closeConnection"`
+	// Stream consumes the response body as a stream and records its timings
+	Stream bool `json:"stream"`
+	// Assertions are checked on the response
+	Assertions Assertions `json:"assertions"`
+
+	// options are the parsed options of the request definition, e.g. URL#count#options
+	options url.Values
+	count   uint
+
+	templates httpTemplates
+	counter   *counter
+	proxy     *proxyDialer
+	// roundTripper is created once per request definition, so connections can be reused
+	roundTripper http.RoundTripper
+
+	// assertionFailures counts the responses failing the assertions
+	assertionFailures *counter
+}
+
+// httpTemplates are the parsed templates of the templated fields
+type httpTemplates struct {
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+// parseHTTPOptions sets the protocol options from the options of the request definition
+func (request *HTTPRequest) parseHTTPOptions(scheme string, options url.Values) error {
+	if v := options.Get("protocol"); v != "" {
+		switch v {
+		case HTTPProtocolHTTP1:
+		case HTTPProtocolH2C:
+			if scheme != "http" {
+				return errors.New("h2c protocol requires http scheme")
+			}
+		case HTTPProtocolH2:
+			if scheme != "https" {
+				return errors.New("h2 protocol requires https scheme")
+			}
+		default:
+			return emperror.With(errors.New("invalid protocol"), "protocol", v)
+		}
+		request.Protocol = v
+	}
+
+	var err error
+	if v := options.Get("insecure"); v != "" {
+		if request.Insecure, err = strconv.ParseBool(v); err != nil {
+			return errors.WrapIf(err, "invalid insecure")
+		}
+	}
+
+	if v := options.Get("closeConnection"); v != "" {
+		if request.CloseConnection, err = strconv.ParseBool(v); err != nil {
+			return errors.WrapIf(err, "invalid closeConnection")
+		}
+	}
+
+	if v := options.Get("stream"); v != "" {
+		if request.Stream, err = strconv.ParseBool(v); err != nil {
+			return errors.WrapIf(err, "invalid stream")
+		}
+	}
+
+	if v := options.Get("method"); v != "" {
+		request.Method = strings.ToUpper(v)
+	}
+
+	request.Body = options.Get("body")
+
+	for _, header := range options["requestHeader"] {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return emperror.With(errors.New("request header must be in the Name:value format"), "requestHeader", header)
+		}
+		if request.Headers == nil {
+			request.Headers = make(map[string]string)
+		}
+		request.Headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	if request.Assertions, err = parseAssertions(options); err != nil {
+		return err
+	}
+	if request.Assertions.needsBody() && request.Stream {
+		return errors.New("body assertions can not be used on streams")
+	}
+	if !request.Assertions.empty() && request.assertionFailures == nil {
+		request.assertionFailures = &counter{}
+	}
+
+	return request.parseHTTPTemplates()
+}
+
+// parseHTTPTemplates parses the templated URL, body and headers
+func (request *HTTPRequest) parseHTTPTemplates() error {
+	var err error
+	if request.templates.url, err = parseTemplate("url", request.URL); err != nil {
+		return err
+	}
+	if request.templates.body, err = parseTemplate("body", request.Body); err != nil {
+		return err
+	}
+	for name, value := range request.Headers {
+		t, err := parseTemplate(name, value)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			continue
+		}
+		if request.templates.headers == nil {
+			request.templates.headers = make(map[string]*template.Template)
+		}
+		request.templates.headers[name] = t
+	}
+
+	if request.counter == nil && (request.templates.url != nil || request.templates.body != nil || request.templates.headers != nil) {
+		request.counter = &counter{}
+	}
+
+	return nil
+}
+
+// transport creates the round tripper of the configured protocol
+func (request HTTPRequest) transport() http.RoundTripper {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: request.Insecure, // nolint:gosec
+	}
+
+	switch request.Protocol {
+	case HTTPProtocolH2C:
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), httpDialTimeout)
+				defer cancel()
+
+				return request.proxy.dial(ctx, "http", addr)
+			},
+		}
+	case HTTPProtocolH2:
+		transport := &http2.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+		if request.proxy != nil {
+			transport.DialTLS = func(network, addr string, config *tls.Config) (net.Conn, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), httpDialTimeout)
+				defer cancel()
+
+				conn, err := request.proxy.dial(ctx, "https", addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, config)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			}
+		}
+		return transport
+	case HTTPProtocolHTTP1:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		transport.Proxy = request.httpProxy()
+		return transport
+	default:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		transport.Proxy = request.httpProxy()
+		return transport
+	}
+}
+
+// httpProxy returns the proxy function of the transport, without proxy settings the
+// environment variables are ignored like by the other request types
+func (request HTTPRequest) httpProxy() func(*http.Request) (*url.URL, error) {
+	if request.proxy == nil {
+		return nil
+	}
+
+	return request.proxy.httpProxy
 }
 
 func (request HTTPRequest) Count() uint {
 	return request.count
 }
 
-func (request HTTPRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) {
+func (request HTTPRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	return request.doIncoming(Incoming{Headers: incomingRequestHeaders}, logger)
+}
+
+// render returns the request with its templated fields rendered
+func (request HTTPRequest) render(incoming Incoming) (HTTPRequest, error) {
+	if request.counter == nil {
+		return request, nil
+	}
+
+	data := templateData{
+		Incoming: incoming,
+		Counter:  request.counter.next(),
+	}
+
+	rendered := request
+	var err error
+	if rendered.URL, err = renderTemplate(request.templates.url, request.URL, data); err != nil {
+		return request, err
+	}
+	if rendered.Body, err = renderTemplate(request.templates.body, request.Body, data); err != nil {
+		return request, err
+	}
+	if request.templates.headers != nil {
+		rendered.Headers = make(map[string]string, len(request.Headers))
+		for name, value := range request.Headers {
+			if rendered.Headers[name], err = renderTemplate(request.templates.headers[name], value, data); err != nil {
+				return request, err
+			}
+		}
+	}
+
+	return rendered, nil
+}
+
+func (request HTTPRequest) doIncoming(incoming Incoming, logger log.Logger) error {
+	request, err := request.render(incoming)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"url": request.URL,
+		}).Error(err.Error())
+		return err
+	}
+	incomingRequestHeaders := incoming.Headers
+
 	correlationID := uuid.New()
 	logger.WithFields(log.Fields{
 		"url":           request.URL,
 		"correlationID": correlationID,
 	}).Info("outgoing request")
 
-	httpClient := &http.Client{}
-	httpReq, err := http.NewRequest("GET", request.URL, nil)
+	httpClient := &http.Client{
+		Transport: request.roundTripper,
+	}
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var requestBody io.Reader
+	if request.Body != "" {
+		requestBody = strings.NewReader(request.Body)
+	}
+	httpReq, err := http.NewRequest(method, request.URL, requestBody)
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"url": request.URL,
 		}).Error(err.Error())
-		return
+		return err
 	}
-	httpReq.Close = true
+	// connections are reused by the transport of the request definition unless asked otherwise
+	httpReq.Close = request.CloseConnection
 
 	propagateHeaders(incomingRequestHeaders, httpReq)
+	for name, value := range request.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	// the Host header is ignored by the HTTP client
+	if host, ok := request.Headers["Host"]; ok {
+		httpReq.Host = host
+	}
+
+	start := time.Now()
+	var ttfb time.Duration
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(httpReq.Context(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			ttfb = time.Since(start)
+		},
+	}))
 
 	response, err := httpClient.Do(httpReq)
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"url": request.URL,
 		}).Error(err.Error())
-		return
+		return err
 	}
 	defer response.Body.Close()
 
-	logger.WithFields(log.Fields{
+	logger = logger.WithFields(log.Fields{
 		"url":           request.URL,
 		"responseCode":  response.StatusCode,
+		"protocol":      response.Proto,
 		"correlationID": correlationID,
-	}).Info("response to outgoing request")
+	})
+
+	if request.Stream {
+		stats, err := consumeStream(response, start)
+		fields := stats.fields()
+		fields["ttfb"] = ttfb
+		logger = logger.WithFields(fields)
+		if err != nil {
+			logger.Error(err)
+			return err
+		}
+	}
+
+	var body []byte
+	if request.Assertions.needsBody() {
+		body, err = io.ReadAll(io.LimitReader(response.Body, maxAssertedBodySize+1))
+		if err != nil {
+			err = errors.WrapIf(err, "could not read response body")
+			logger.Error(err)
+			return err
+		}
+	}
+	latency := time.Since(start)
+
+	logger.Info("response to outgoing request")
+
+	if !request.Assertions.empty() {
+		if err := request.Assertions.check(response, body, latency); err != nil {
+			logger.WithFields(log.Fields{
+				"assertion":         err.(AssertionError).Assertion,
+				"latency":           latency,
+				"assertionFailures": request.assertionFailures.next(),
+			}).Error(err.Error())
+			return err
+		}
+	}
+
+	// the expected status codes replace the default check
+	if len(request.Assertions.StatusCodes) == 0 && response.StatusCode >= http.StatusBadRequest {
+		return StatusCodeError{Code: response.StatusCode}
+	}
+
+	return nil
+}
+
+type streamStats struct {
+	bytes      int64
+	events     uint
+	sse        bool
+	firstChunk time.Duration
+	duration   time.Duration
+}
+
+func (s streamStats) fields() log.Fields {
+	fields := log.Fields{
+		"bytes":      s.bytes,
+		"firstChunk": s.firstChunk,
+		"duration":   s.duration,
+	}
+	if s.sse {
+		fields["events"] = s.events
+	}
+
+	return fields
+}
+
+// consumeStream reads the response body until the end of the stream and
+// counts the events of Server-Sent Events streams
+func consumeStream(response *http.Response, start time.Time) (streamStats, error) {
+	stats := streamStats{
+		sse: strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream"),
+	}
+
+	var line []byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := response.Body.Read(buf)
+		if n > 0 {
+			if stats.bytes == 0 {
+				stats.firstChunk = time.Since(start)
+			}
+			stats.bytes += int64(n)
+
+			// an event is terminated by an empty line
+			if stats.sse {
+				for _, b := range buf[:n] {
+					if b != '\n' {
+						line = append(line, b)
+						continue
+					}
+					if len(bytes.TrimSuffix(line, []byte("\r"))) == 0 {
+						stats.events++
+					}
+					line = line[:0]
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stats.duration = time.Since(start)
+			return stats, errors.WrapIf(err, "could not read stream")
+		}
+	}
+	stats.duration = time.Since(start)
+
+	return stats, nil
 }
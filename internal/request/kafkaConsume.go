@@ -26,7 +26,7 @@ func (request KafkaConsumeRequest) SetConsumer(consumer *kafka.Consumer) {
 	request.consumer = consumer
 }
 
-func (request KafkaConsumeRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) {
+func (request KafkaConsumeRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
 	correlationID := uuid.New()
 	loggerWithFields := logger.WithFields(log.Fields{
 		"correlationID":   correlationID,
@@ -40,8 +40,10 @@ func (request KafkaConsumeRequest) Do(incomingRequestHeaders http.Header, logger
 	message, err := request.consumer.Consume(context.Background())
 	if err != nil {
 		loggerWithFields.Error(err.Error())
-		return
+		return err
 	}
 
 	loggerWithFields.WithField("message", message).Info("message received")
+
+	return nil
 }
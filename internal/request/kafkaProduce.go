@@ -3,6 +3,7 @@ package request
 import (
 	"context"
 	"net/http"
+	"text/template"
 
 	"github.com/banzaicloud/allspark/internal/kafka"
 	"github.com/banzaicloud/allspark/internal/platform/log"
@@ -16,13 +17,29 @@ type KafkaProduceRequest struct {
 
 	producer *kafka.Producer
 	count    uint
+
+	messageTemplate *template.Template
+	counter         *counter
 }
 
 func (request KafkaProduceRequest) Count() uint {
 	return request.count
 }
 
-func (request KafkaProduceRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) {
+func (request KafkaProduceRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	return request.doIncoming(Incoming{Headers: incomingRequestHeaders}, logger)
+}
+
+func (request KafkaProduceRequest) doIncoming(incoming Incoming, logger log.Logger) error {
+	message, err := renderTemplate(request.messageTemplate, request.Message, templateData{
+		Incoming: incoming,
+		Counter:  request.counter.next(),
+	})
+	if err != nil {
+		logger.WithField("topic", request.Topic).Error(err.Error())
+		return err
+	}
+
 	correlationID := uuid.New()
 	loggerWithFields := logger.WithFields(log.Fields{
 		"correlationID":   correlationID,
@@ -32,11 +49,13 @@ func (request KafkaProduceRequest) Do(incomingRequestHeaders http.Header, logger
 
 	request.producer.SetLogger(loggerWithFields)
 
-	err := request.producer.Produce(context.Background(), request.Message)
+	err = request.producer.Produce(context.Background(), message)
 	if err != nil {
 		loggerWithFields.Error(err.Error())
-		return
+		return err
 	}
 
-	loggerWithFields.WithField("message", request.Message).Info("message sent")
+	loggerWithFields.WithField("message", message).Info("message sent")
+
+	return nil
 }
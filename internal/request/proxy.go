@@ -0,0 +1,303 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// ProxySchemeHTTP tunnels the connections through an HTTP proxy with the CONNECT method
+	ProxySchemeHTTP = "http"
+	// ProxySchemeSOCKS5 tunnels the connections through a SOCKS5 proxy
+	ProxySchemeSOCKS5 = "socks5"
+
+	// proxyDirect disables the default proxy of a request
+	proxyDirect = "direct"
+
+	// proxyDialTimeout bounds the dials including the proxy handshakes
+	proxyDialTimeout = 30 * time.Second
+)
+
+// ProxyConfig holds the settings of the proxy the requests are sent through
+type ProxyConfig struct {
+	// URL of the proxy in the http://[user:password@]host:port or
+	// socks5://[user:password@]host:port format
+	URL string `mapstructure:"url"`
+
+	// FromEnvironment uses the proxy set by the HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY environment variables when URL is not set
+	FromEnvironment bool `mapstructure:"fromEnvironment"`
+
+	// configured is set when the proxy of a request is set explicitly
+	configured bool
+}
+
+// defaultProxy is the proxy of the requests which do not set their own
+var defaultProxy ProxyConfig
+
+// SetDefaultProxy sets the proxy of the requests created afterwards which do not set their own
+func SetDefaultProxy(config ProxyConfig) {
+	defaultProxy = config
+}
+
+// Validate validates the proxy configuration
+func (c ProxyConfig) Validate() (ProxyConfig, error) {
+	if c.URL == "" {
+		return c, nil
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c, errors.WrapIf(err, "invalid proxy URL")
+	}
+	if u.Scheme != ProxySchemeHTTP && u.Scheme != ProxySchemeSOCKS5 {
+		return c, emperror.With(errors.New("proxy scheme must be http or socks5"), "proxy", u.Redacted())
+	}
+	if u.Host == "" {
+		return c, emperror.With(errors.New("proxy host is missing"), "proxy", u.Redacted())
+	}
+
+	return c, nil
+}
+
+// enabled returns whether the proxy settings are set
+func (c ProxyConfig) enabled() bool {
+	return c.URL != "" || c.FromEnvironment || c.configured
+}
+
+// parseProxyConfig creates the proxy settings from the options of the request definition,
+// falling back to the default proxy
+func parseProxyConfig(options url.Values) (ProxyConfig, error) {
+	config := defaultProxy
+
+	switch v := options.Get("proxy"); v {
+	case "":
+	case proxyDirect:
+		config = ProxyConfig{configured: true}
+	default:
+		config = ProxyConfig{URL: v, configured: true}
+	}
+
+	if v := options.Get("proxyFromEnvironment"); v != "" {
+		var err error
+		if config.FromEnvironment, err = strconv.ParseBool(v); err != nil {
+			return config, errors.WrapIf(err, "invalid proxyFromEnvironment")
+		}
+		config.configured = true
+	}
+
+	return config.Validate()
+}
+
+// proxyDialer opens the connections of the requests through the configured proxy,
+// a nil proxyDialer dials the targets directly
+type proxyDialer struct {
+	url         *url.URL
+	environment func(*url.URL) (*url.URL, error)
+}
+
+// newProxyDialer creates the dialer of the proxy settings, or returns nil
+// when the settings are not set so the targets are dialed directly
+func newProxyDialer(config ProxyConfig) (*proxyDialer, error) {
+	if !config.enabled() {
+		return nil, nil
+	}
+
+	d := &proxyDialer{}
+	if config.URL != "" {
+		u, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, errors.WrapIf(err, "invalid proxy URL")
+		}
+		d.url = u
+	} else if config.FromEnvironment {
+		d.environment = httpproxy.FromEnvironment().ProxyFunc()
+	}
+
+	return d, nil
+}
+
+// proxyURL returns the URL of the proxy of the target, or nil if the target is dialed directly
+func (d *proxyDialer) proxyURL(target *url.URL) (*url.URL, error) {
+	switch {
+	case d == nil:
+		return nil, nil
+	case d.url != nil:
+		return d.url, nil
+	case d.environment != nil:
+		return d.environment(target)
+	default:
+		return nil, nil
+	}
+}
+
+// httpProxy returns the proxy of the HTTP request, see http.Transport.Proxy
+func (d *proxyDialer) httpProxy(req *http.Request) (*url.URL, error) {
+	return d.proxyURL(req.URL)
+}
+
+// dial opens a connection to the address through the proxy of the target,
+// the scheme of the target selects the proxy from the environment variables
+func (d *proxyDialer) dial(ctx context.Context, scheme string, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, proxyDialTimeout)
+	defer cancel()
+
+	proxyURL, err := d.proxyURL(&url.URL{Scheme: scheme, Host: addr})
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not get proxy")
+	}
+
+	if proxyURL == nil {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case ProxySchemeHTTP:
+		return dialConnect(ctx, proxyURL, addr)
+	case ProxySchemeSOCKS5:
+		return dialSOCKS5(ctx, proxyURL, addr)
+	default:
+		return nil, emperror.With(errors.New("unsupported proxy scheme"), "proxy", proxyURL.Redacted())
+	}
+}
+
+// dialConnect opens a tunnel to the address with the CONNECT method of an HTTP proxy
+func dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddress(proxyURL, "80"))
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not connect to proxy")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)          // nolint:errcheck
+		defer conn.SetDeadline(time.Time{}) // nolint:errcheck
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, errors.WrapIf(err, "could not send CONNECT request to proxy")
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.WrapIf(err, "could not read CONNECT response of proxy")
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, emperror.With(errors.New("proxy refused to connect"), "status", response.Status, "address", addr)
+	}
+
+	// data sent by the target before the first read is already buffered
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+
+	return conn, nil
+}
+
+// dialSOCKS5 opens a connection to the address through a SOCKS5 proxy
+func dialSOCKS5(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		auth = &proxy.Auth{
+			User:     user.Username(),
+			Password: password,
+		}
+	}
+
+	forward := &recordingDialer{}
+	dialer, err := proxy.SOCKS5("tcp", proxyAddress(proxyURL, "1080"), auth, forward)
+	if err != nil {
+		return nil, errors.WrapIf(err, "could not create SOCKS5 dialer")
+	}
+
+	if _, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr); err != nil {
+		return nil, errors.WrapIf(err, "could not connect through proxy")
+	}
+
+	// the wrapper of the SOCKS5 dialer hides the half-close of the connection
+	// to the proxy, which carries the tunnel after the handshake
+	return forward.conn, nil
+}
+
+// recordingDialer dials directly and keeps the last dialed connection
+type recordingDialer struct {
+	conn net.Conn
+}
+
+func (d *recordingDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	d.conn = conn
+
+	return conn, err
+}
+
+// proxyAddress returns the host:port address of the proxy with the default port if not set
+func proxyAddress(proxyURL *url.URL, defaultPort string) string {
+	if proxyURL.Port() != "" {
+		return proxyURL.Host
+	}
+
+	return net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+}
+
+// bufferedConn reads the data buffered while reading the CONNECT response first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
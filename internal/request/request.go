@@ -47,16 +47,23 @@ var (
 )
 
 type Request interface {
-	Do(incomingRequestHeaders http.Header, logger log.Logger)
+	// Do sends the request, logs its outcome and returns the error of failed requests
+	Do(incomingRequestHeaders http.Header, logger log.Logger) error
 	Count() uint
 }
 
 type Requests []Request
 
+// CreateRequestsFromStringSlice creates the requests from definitions in the
+// URL#count or URL#count#options format, where the options of every request
+// type are URL encoded key-value pairs, e.g. protocol=h2c&insecure=true,
+// mode=echo&size=1KiB or probability=0.3
 func CreateRequestsFromStringSlice(reqs []string, logger log.Logger) (Requests, error) {
 	var request Request
 
 	requests := make(Requests, 0)
+	// the requests created together share the circuit breakers of their targets
+	breakers := newBreakers()
 
 	for _, req := range reqs {
 		pieces := strings.Split(req, "#")
@@ -70,18 +77,24 @@ func CreateRequestsFromStringSlice(reqs []string, logger log.Logger) (Requests,
 			}
 		}
 
-		if len(pieces) == 2 {
+		if len(pieces) >= 2 {
 			count, err := strconv.ParseUint(pieces[1], 10, 64)
 			if err != nil {
 				continue
 			}
-			request = HTTPRequest{
+			httpRequest := HTTPRequest{
 				URL:   pieces[0],
 				count: uint(count),
 			}
+			if len(pieces) > 2 {
+				if httpRequest.options, err = url.ParseQuery(pieces[2]); err != nil {
+					return nil, emperror.With(errors.WrapIf(err, "invalid request options"), "request", req)
+				}
+			}
+			request = httpRequest
 		}
 
-		err := requests.AddRequest(request.(HTTPRequest), logger)
+		err := requests.addRequest(request.(HTTPRequest), breakers, logger)
 		if err != nil {
 			return nil, errors.WrapIf(err, "could not add request")
 		}
@@ -91,45 +104,201 @@ func CreateRequestsFromStringSlice(reqs []string, logger log.Logger) (Requests,
 }
 
 func (r *Requests) AddRequest(request HTTPRequest, logger log.Logger) error {
-	u, err := url.Parse(request.URL)
-	if err == nil && (u.Scheme == "" || u.Host == "") {
-		return emperror.With(errors.New("invalid URL"), "url", request.URL)
+	return r.addRequest(request, newBreakers(), logger)
+}
+
+func (r *Requests) addRequest(request HTTPRequest, breakers *breakers, logger log.Logger) error {
+	balancerConfig, err := parseBalancerConfig(request.options)
+	if err != nil {
+		return emperror.With(errors.WrapIf(err, "invalid load balancer"), "url", request.URL)
+	}
+
+	var req Request
+	if balancerConfig.Enabled() {
+		req, err = newBalancedRequest(request, balancerConfig, func(request HTTPRequest) (Request, error) {
+			return newTargetRequest(request, breakers, logger)
+		})
+	} else {
+		req, err = newTargetRequest(request, breakers, logger)
 	}
 	if err != nil {
 		return err
 	}
 
+	rule, err := parseRule(request.options)
+	if err != nil {
+		return emperror.With(errors.WrapIf(err, "invalid request rule"), "url", request.URL)
+	}
+	if !rule.empty() {
+		req = ruledRequest{
+			Request: req,
+			rule:    rule,
+		}
+	}
+
+	logger.WithFields(log.Fields{
+		"url":   request.URL,
+		"count": request.Count(),
+	}).Info("request added")
+
+	*r = append(*r, req)
+
+	return nil
+}
+
+// newTargetRequest creates the request of a single target with the circuit breaker of the target
+func newTargetRequest(request HTTPRequest, breakers *breakers, logger log.Logger) (Request, error) {
+	req, target, err := newRequest(request, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	breakerConfig, err := parseBreakerConfig(request.options)
+	if err != nil {
+		return nil, emperror.With(errors.WrapIf(err, "invalid circuit breaker"), "url", request.URL)
+	}
+	if breakerConfig.Enabled() {
+		breaker, err := breakers.get(breakerConfig, target)
+		if err != nil {
+			return nil, emperror.With(err, "url", request.URL)
+		}
+		req = breakerRequest{
+			Request: req,
+			breaker: breaker,
+		}
+	}
+
+	return req, nil
+}
+
+// newRequest creates the request of the URL scheme, and returns its target host
+func newRequest(request HTTPRequest, logger log.Logger) (Request, string, error) {
+	// templated URLs are validated by rendering them with empty data
+	sampleURL, err := renderSample(request.URL)
+	if err != nil {
+		return nil, "", emperror.With(err, "url", request.URL)
+	}
+
+	u, err := url.Parse(sampleURL)
+	if err == nil && (u.Scheme == "" || u.Host == "") {
+		return nil, "", emperror.With(errors.New("invalid URL"), "url", request.URL)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	proxyConfig, err := parseProxyConfig(request.options)
+	if err != nil {
+		return nil, "", emperror.With(errors.WrapIf(err, "invalid proxy"), "url", request.URL)
+	}
+	proxy, err := newProxyDialer(proxyConfig)
+	if err != nil {
+		return nil, "", emperror.With(err, "url", request.URL)
+	}
+
 	var req Request
 
+	if isTemplate(request.URL) && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "kafka-produce" {
+		return nil, "", emperror.With(errors.New("templates are only supported in http urls and kafka messages"), "url", request.URL)
+	}
+
+	// the options of every request type are set in the URL#count#options format, the query
+	// is only part of the URL where it is sent to the target
+	switch u.Scheme {
+	case "grpc", "tcp", "udp":
+		if u.RawQuery != "" {
+			return nil, "", emperror.With(errors.New("query is not supported, set the options in the URL#count#options format"), "url", request.URL)
+		}
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" && hasAssertionOptions(request.options) {
+		return nil, "", emperror.With(errors.New("assertions are only supported in http requests"), "url", request.URL)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "ws", "wss", "grpc", "tcp":
+	default:
+		if proxyConfig.configured {
+			return nil, "", emperror.With(errors.New("proxies are only supported in http, ws, grpc and tcp requests"), "url", request.URL)
+		}
+		proxy = nil
+	}
+
 	switch u.Scheme {
 	case "http", "https":
+		if err := request.parseHTTPOptions(u.Scheme, request.options); err != nil {
+			return nil, "", emperror.With(errors.WrapIf(err, "invalid http request options"), "url", request.URL)
+		}
+		request.proxy = proxy
+		request.roundTripper = request.transport()
 		req = request
+	case "ws", "wss":
+		wsRequest := WebSocketRequest{
+			URL:   request.URL,
+			proxy: proxy,
+			count: request.Count(),
+		}
+		if err := wsRequest.parseWebSocketOptions(request.options); err != nil {
+			return nil, "", emperror.With(errors.WrapIf(err, "invalid ws request options"), "url", request.URL)
+		}
+		req = wsRequest
 	case "grpc":
 		p := strings.SplitN(u.Path, "/", 3)
 		if len(p) != 3 {
-			return errors.New("invalid grpc url; service and/or method is missing")
+			return nil, "", errors.New("invalid grpc url; service and/or method is missing")
 		}
 
-		req = GRPCRequest{
+		grpcRequest := GRPCRequest{
 			Host:    u.Host,
 			Service: p[1],
 			Method:  p[2],
-			count:   request.Count(),
+
+			resolver: &grpcMethodResolver{},
+			proxy:    proxy,
+			count:    request.Count(),
+		}
+		if err := grpcRequest.parseGRPCOptions(request.options); err != nil {
+			return nil, "", emperror.With(errors.WrapIf(err, "invalid grpc request options"), "url", request.URL)
 		}
+		req = grpcRequest
 	case "tcp":
 		port, err := strconv.Atoi(u.Port())
 		if err != nil {
-			return errors.WrapIf(err, "could not convert port to int")
+			return nil, "", errors.WrapIf(err, "could not convert port to int")
 		}
-		req = TCPRequest{
-			Host:        u.Hostname(),
-			Port:        port,
-			PayloadSize: request.Count() * 1024 * 1024,
+		tcpRequest := TCPRequest{
+			Host:  u.Hostname(),
+			Port:  port,
+			proxy: proxy,
+			count: request.Count(),
 		}
+		if err := tcpRequest.parseTCPOptions(request.options); err != nil {
+			return nil, "", emperror.With(errors.WrapIf(err, "invalid tcp request options"), "url", request.URL)
+		}
+		// without an explicit size the count is the payload size in MiB
+		if request.options.Get("size") == "" {
+			tcpRequest.PayloadSize = request.Count() * 1024 * 1024
+			tcpRequest.count = 1
+		}
+		req = tcpRequest
+	case "udp":
+		port, err := strconv.Atoi(u.Port())
+		if err != nil {
+			return nil, "", errors.WrapIf(err, "could not convert port to int")
+		}
+		udpRequest := UDPRequest{
+			Host:  u.Hostname(),
+			Port:  port,
+			count: request.Count(),
+		}
+		if err := udpRequest.parseUDPOptions(request.options); err != nil {
+			return nil, "", emperror.With(errors.WrapIf(err, "invalid udp request options"), "url", request.URL)
+		}
+		req = udpRequest
 	case "kafka-consume":
 		pieces := strings.Split(u.RawQuery, "=")
 		if len(pieces) != 2 {
-			return errors.New("invalid kafka consume url; provide only the consumer group after the '?'")
+			return nil, "", errors.New("invalid kafka consume url; provide only the consumer group after the '?'")
 		}
 
 		bootstrapServer := u.Host
@@ -143,32 +312,41 @@ func (r *Requests) AddRequest(request HTTPRequest, logger log.Logger) error {
 			count:    request.Count(),
 		}
 	case "kafka-produce":
-		pieces := strings.Split(u.RawQuery, "=")
-		if len(pieces) != 2 {
-			return errors.New("invalid kafka produce url; provide only the message after the '?'")
+		// the message is taken from the original URL as it may be a template
+		address, query, _ := strings.Cut(request.URL, "?")
+		_, message, ok := strings.Cut(query, "=")
+		if !ok {
+			return nil, "", errors.New("invalid kafka produce url; provide only the message after the '?'")
+		}
+		if isTemplate(address) {
+			return nil, "", emperror.With(errors.New("templates are only supported in the message of kafka produce urls"), "url", request.URL)
 		}
 
 		bootstrapServer := u.Host
 		topic := strings.Trim(u.Path, "/")
-		message := pieces[1]
+		messageTemplate, err := parseTemplate("message", message)
+		if err != nil {
+			return nil, "", emperror.With(err, "url", request.URL)
+		}
 
 		producer := kafka.NewProducer(bootstrapServer, topic, logger)
 
-		req = KafkaProduceRequest{
+		kafkaRequest := KafkaProduceRequest{
 			producer: producer,
 			Message:  message,
 			count:    request.Count(),
+
+			messageTemplate: messageTemplate,
+		}
+		if messageTemplate != nil {
+			kafkaRequest.counter = &counter{}
 		}
+		req = kafkaRequest
+	default:
+		return nil, "", emperror.With(errors.New("unsupported scheme"), "url", request.URL)
 	}
 
-	logger.WithFields(log.Fields{
-		"url":   request.URL,
-		"count": request.Count(),
-	}).Info("request added")
-
-	*r = append(*r, req)
-
-	return nil
+	return req, u.Host, nil
 }
 
 func propagateHeaders(incomingRequestHeaders http.Header, httpReq *http.Request) {
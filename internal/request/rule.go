@@ -0,0 +1,200 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+)
+
+// Rule decides whether a request is sent for an incoming request
+type Rule struct {
+	// Probability of sending the request, it is always sent if not set
+	Probability float64
+	// Group is the name of the alternatives of which one is sent,
+	// chosen randomly by their weights
+	Group string
+	// Weight of the request in its group, defaults to 1
+	Weight uint
+	// Headers are the incoming request headers that must be present, with
+	// the given value if not empty
+	Headers map[string]string
+	// Paths are patterns of which one must match the incoming request path
+	Paths []string
+}
+
+// parseRule creates the rule from the options of the request definition
+func parseRule(options url.Values) (Rule, error) {
+	rule := Rule{
+		Group:  options.Get("group"),
+		Weight: 1,
+		Paths:  options["path"],
+	}
+
+	var err error
+	if v := options.Get("probability"); v != "" {
+		if rule.Probability, err = strconv.ParseFloat(v, 64); err != nil {
+			return rule, errors.WrapIf(err, "invalid probability")
+		}
+		if rule.Probability <= 0 || rule.Probability > 1 {
+			return rule, emperror.With(errors.New("probability must be in the (0, 1] range"), "probability", v)
+		}
+	}
+
+	if v := options.Get("weight"); v != "" {
+		weight, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return rule, errors.WrapIf(err, "invalid weight")
+		}
+		if rule.Group == "" {
+			return rule, errors.New("weight requires group")
+		}
+		rule.Weight = uint(weight)
+	}
+
+	for _, header := range options["header"] {
+		if rule.Headers == nil {
+			rule.Headers = make(map[string]string)
+		}
+		name, value, _ := strings.Cut(header, ":")
+		rule.Headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	for _, pattern := range rule.Paths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return rule, emperror.With(errors.WrapIf(err, "invalid path pattern"), "path", pattern)
+		}
+	}
+
+	return rule, nil
+}
+
+func (r Rule) empty() bool {
+	return r.Probability == 0 && r.Group == "" && len(r.Headers) == 0 && len(r.Paths) == 0
+}
+
+// matches returns whether the conditions of the rule are met by the incoming request
+func (r Rule) matches(incomingRequestHeaders http.Header, incomingPath string) bool {
+	for name, value := range r.Headers {
+		values := incomingRequestHeaders.Values(name)
+		if len(values) == 0 {
+			return false
+		}
+		if value != "" && !contains(values, value) {
+			return false
+		}
+	}
+
+	if len(r.Paths) > 0 {
+		matched := false
+		for _, pattern := range r.Paths {
+			if ok, _ := path.Match(pattern, incomingPath); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	// nolint:gosec
+	return r.Probability == 0 || rand.Float64() < r.Probability
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ruledRequest is a request that is sent according to its rule
+type ruledRequest struct {
+	Request
+
+	rule Rule
+}
+
+// Select returns the requests to send for an incoming request; the requests
+// whose rule is not met are left out, and one request is chosen by weight
+// from each group of the remaining ones
+func (r Requests) Select(incoming Incoming) Requests {
+	selected := make(Requests, 0, len(r))
+
+	var groups []string
+	alternatives := make(map[string][]ruledRequest)
+	for _, request := range r {
+		ruled, ok := request.(ruledRequest)
+		if !ok {
+			selected = append(selected, bind(request, incoming))
+			continue
+		}
+
+		if !ruled.rule.matches(incoming.Headers, incoming.Path) {
+			continue
+		}
+
+		if ruled.rule.Group == "" {
+			selected = append(selected, bind(ruled.Request, incoming))
+			continue
+		}
+
+		if _, ok := alternatives[ruled.rule.Group]; !ok {
+			groups = append(groups, ruled.rule.Group)
+		}
+		alternatives[ruled.rule.Group] = append(alternatives[ruled.rule.Group], ruled)
+	}
+
+	for _, group := range groups {
+		if request, ok := choose(alternatives[group]); ok {
+			selected = append(selected, bind(request, incoming))
+		}
+	}
+
+	return selected
+}
+
+// choose picks one of the requests randomly by their weights
+func choose(requests []ruledRequest) (Request, bool) {
+	var total uint
+	for _, request := range requests {
+		total += request.rule.Weight
+	}
+	if total == 0 {
+		return nil, false
+	}
+
+	// nolint:gosec
+	n := uint(rand.Int63n(int64(total)))
+	for _, request := range requests {
+		if n < request.rule.Weight {
+			return request.Request, true
+		}
+		n -= request.rule.Weight
+	}
+
+	return nil, false
+}
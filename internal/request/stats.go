@@ -0,0 +1,47 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"time"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+// durationFields returns the minimum, average and maximum of the durations as
+// log fields prefixed with the given name, e.g. rttMin, rttAvg and rttMax
+func durationFields(name string, durations []time.Duration) log.Fields {
+	fields := log.Fields{}
+	if len(durations) == 0 {
+		return fields
+	}
+
+	var sum time.Duration
+	min, max := durations[0], durations[0]
+	for _, d := range durations {
+		sum += d
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	fields[name+"Min"] = min
+	fields[name+"Avg"] = sum / time.Duration(len(durations))
+	fields[name+"Max"] = max
+
+	return fields
+}
@@ -15,51 +15,452 @@
 package request
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"emperror.dev/emperror"
 	"emperror.dev/errors"
 
 	"github.com/banzaicloud/allspark/internal/platform/log"
 )
 
+const (
+	// TCPModeSend writes the payload and closes the write side, optionally waiting for the server to close the connection
+	TCPModeSend = "send"
+	// TCPModeEcho writes the payload and reads it back from an echoing server
+	TCPModeEcho = "echo"
+	// TCPModeFramed writes the payload as a length-prefixed frame and reads the response frame
+	TCPModeFramed = "framed"
+
+	// TCPDefaultMaxFrameSize is the default limit of the payload size of a frame in framed mode
+	TCPDefaultMaxFrameSize = 16 * 1024 * 1024
+
+	tcpChunkSize = 32 * 1024
+	// tcpDefaultTimeout is the default time a connection can be idle
+	tcpDefaultTimeout = 30 * time.Second
+
+	// payloadPattern is repeated in the payloads so echoed data can be verified
+	payloadPattern = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+// payloadBuffer holds the payload pattern repeated to cover a chunk starting at any offset,
+// so chunks of the payload are slices of it
+var payloadBuffer = bytes.Repeat([]byte(payloadPattern), tcpChunkSize/len(payloadPattern)+2)
+
 type TCPRequest struct {
 	Host        string `json:"host"`
 	Port        int    `json:"port"`
 	PayloadSize uint   `json:"payloadSize"`
+
+	// Mode is one of send, echo or framed
+	Mode string `json:"mode"`
+	// Connections is the number of consecutive connections opened by a single request
+	Connections uint `json:"connections"`
+	// Wait makes send mode wait for the server to close the connection
+	Wait bool `json:"wait"`
+	// MaxFrameSize limits the payload size in framed mode
+	MaxFrameSize uint `json:"maxFrameSize"`
+	// Timeout limits dialing and the time a connection can be idle
+	Timeout time.Duration `json:"timeout"`
+
+	proxy *proxyDialer
+	count uint
+}
+
+// parseTCPOptions sets the payload and mode options from the options of the request definition
+func (request *TCPRequest) parseTCPOptions(options url.Values) error {
+	if v := options.Get("size"); v != "" {
+		size, err := parseSize(v)
+		if err != nil {
+			return errors.WrapIf(err, "invalid size")
+		}
+		request.PayloadSize = size
+	}
+
+	request.Mode = TCPModeSend
+	if v := options.Get("mode"); v != "" {
+		switch v {
+		case TCPModeSend, TCPModeEcho, TCPModeFramed:
+			request.Mode = v
+		default:
+			return emperror.With(errors.New("invalid mode"), "mode", v)
+		}
+	}
+
+	request.Connections = 1
+	if v := options.Get("connections"); v != "" {
+		connections, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || connections == 0 {
+			return emperror.With(errors.New("invalid connections"), "connections", v)
+		}
+		request.Connections = uint(connections)
+	}
+
+	if v := options.Get("wait"); v != "" {
+		wait, err := strconv.ParseBool(v)
+		if err != nil {
+			return emperror.With(errors.New("invalid wait"), "wait", v)
+		}
+		request.Wait = wait
+	}
+
+	request.Timeout = tcpDefaultTimeout
+	if v := options.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return emperror.With(errors.New("invalid timeout"), "timeout", v)
+		}
+		request.Timeout = timeout
+	}
+
+	request.MaxFrameSize = TCPDefaultMaxFrameSize
+	if v := options.Get("maxFrameSize"); v != "" {
+		size, err := parseSize(v)
+		if err != nil || size == 0 || size > math.MaxUint32 {
+			return emperror.With(errors.New("invalid maxFrameSize"), "maxFrameSize", v)
+		}
+		request.MaxFrameSize = size
+	}
+
+	if request.Mode == TCPModeFramed {
+		// the payload size would otherwise default to count MiB, which easily exceeds the frame limit
+		if options.Get("size") == "" {
+			return errors.New("framed mode requires a size option")
+		}
+		if request.PayloadSize > request.MaxFrameSize {
+			return emperror.With(errors.New("size exceeds the maximum frame size"), "size", request.PayloadSize, "maxFrameSize", request.MaxFrameSize)
+		}
+	}
+
+	return nil
 }
 
 func (request TCPRequest) Count() uint {
-	return 1
+	return request.count
 }
 
-func (request TCPRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) {
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", request.Host, request.Port))
+func (request TCPRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	logger = logger.WithFields(log.Fields{
+		"host":        request.Host,
+		"port":        request.Port,
+		"mode":        request.Mode,
+		"payloadSize": request.PayloadSize,
+	})
+
+	var errs error
+	for i := uint(0); i < request.Connections; i++ {
+		stats, err := request.do()
+		if err != nil {
+			logger.WithFields(stats.fields()).Error(err)
+			errs = errors.Append(errs, err)
+			continue
+		}
+		logger.WithFields(stats.fields()).Info("data sent")
+	}
+
+	return errs
+}
+
+type tcpStats struct {
+	sent     int64
+	received int64
+	rtt      time.Duration
+	duration time.Duration
+}
+
+func (s tcpStats) fields() log.Fields {
+	fields := log.Fields{
+		"bytes":         s.sent,
+		"receivedBytes": s.received,
+		"duration":      s.duration,
+	}
+	if s.rtt > 0 {
+		fields["rtt"] = s.rtt
+	}
+	if s.duration > 0 {
+		fields["throughputMiBps"] = float64(s.sent+s.received) / s.duration.Seconds() / (1024 * 1024)
+	}
+
+	return fields
+}
+
+func (request TCPRequest) do() (tcpStats, error) {
+	var stats tcpStats
+
+	ctx, cancel := context.WithTimeout(context.Background(), request.Timeout)
+	defer cancel()
+
+	// the connections are dialed as https, so HTTPS_PROXY applies to them when the proxy is taken from the environment
+	c, err := request.proxy.dial(ctx, "https", net.JoinHostPort(request.Host, strconv.Itoa(request.Port)))
 	if err != nil {
-		logger.Error(errors.WrapIf(err, "could not connect"))
-		return
+		return stats, errors.WrapIf(err, "could not connect")
 	}
-	defer func() {
-		conn.Close()
+	defer c.Close()
+
+	// a stalled peer fails the request instead of blocking it forever, while large transfers can take any time
+	conn := idleTimeoutConn{Conn: c, timeout: request.Timeout}
+
+	start := time.Now()
+	switch request.Mode {
+	case TCPModeFramed:
+		err = request.framed(conn, &stats)
+	case TCPModeEcho:
+		err = request.echo(conn, &stats, start)
+	default:
+		err = request.send(conn, &stats)
+	}
+	stats.duration = time.Since(start)
+
+	return stats, err
+}
+
+// send writes the payload and half-closes the connection, then waits for the server to close it if requested
+func (request TCPRequest) send(conn net.Conn, stats *tcpStats) error {
+	var err error
+	stats.sent, err = writePayload(conn, request.PayloadSize)
+	if err != nil {
+		return errors.WrapIf(err, "could not send data")
+	}
+
+	if err := closeWrite(conn); err != nil {
+		return errors.WrapIf(err, "could not close connection")
+	}
+
+	if !request.Wait {
+		return nil
+	}
+
+	stats.received, err = io.Copy(io.Discard, conn)
+	if err != nil {
+		return errors.WrapIf(err, "could not read data")
+	}
+
+	return nil
+}
+
+// echo writes the payload while reading it back concurrently, then verifies the echoed data
+func (request TCPRequest) echo(conn net.Conn, stats *tcpStats, start time.Time) error {
+	type result struct {
+		received int64
+		rtt      time.Duration
+		err      error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		var r result
+		buf := make([]byte, tcpChunkSize)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if r.received == 0 {
+					r.rtt = time.Since(start)
+				}
+				if !bytes.Equal(buf[:n], payloadChunk(r.received, n)) {
+					r.err = emperror.With(errors.New("echoed data does not match"), "offset", r.received)
+					break
+				}
+				r.received += int64(n)
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				r.err = errors.WrapIf(err, "could not read data")
+				break
+			}
+		}
+		results <- r
 	}()
 
-	s := strings.Repeat(".", 1024)
+	var err error
+	stats.sent, err = writePayload(conn, request.PayloadSize)
+	if err != nil {
+		return errors.WrapIf(err, "could not send data")
+	}
+
+	if err := closeWrite(conn); err != nil {
+		return errors.WrapIf(err, "could not close connection")
+	}
+
+	r := <-results
+	stats.received = r.received
+	stats.rtt = r.rtt
+	if r.err != nil {
+		return r.err
+	}
+
+	if stats.received != stats.sent {
+		return emperror.With(errors.New("echoed data is incomplete"), "sent", stats.sent, "received", stats.received)
+	}
+
+	return nil
+}
+
+// framed writes the payload as a single length-prefixed frame and verifies the response frame
+func (request TCPRequest) framed(conn net.Conn, stats *tcpStats) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(request.PayloadSize))
+
+	start := time.Now()
+	if _, err := conn.Write(header); err != nil {
+		return errors.WrapIf(err, "could not send frame")
+	}
+	var err error
+	stats.sent, err = writePayload(conn, request.PayloadSize)
+	if err != nil {
+		return errors.WrapIf(err, "could not send frame payload")
+	}
+
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return errors.WrapIf(err, "could not read frame")
+	}
+	// the response must be as large as the sent frame
+	if size := binary.BigEndian.Uint32(header); int64(size) != stats.sent {
+		return emperror.With(errors.New("response frame size does not match"), "size", size)
+	}
 
-	logger.WithField("payloadSize", request.PayloadSize).Info("sending data")
+	buf := make([]byte, tcpChunkSize)
+	for stats.received < stats.sent {
+		n := len(buf)
+		if remaining := stats.sent - stats.received; remaining < int64(n) {
+			n = int(remaining)
+		}
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return errors.WrapIf(err, "could not read frame payload")
+		}
+		if !bytes.Equal(buf[:n], payloadChunk(stats.received, n)) {
+			return emperror.With(errors.New("response frame does not match"), "offset", stats.received)
+		}
+		stats.received += int64(n)
+	}
+	stats.rtt = time.Since(start)
 
-	var sum int
-	for {
-		sent, err := conn.Write([]byte(s))
+	return closeWrite(conn)
+}
+
+func writePayload(w io.Writer, size uint) (int64, error) {
+	var sum int64
+	for sum < int64(size) {
+		n := tcpChunkSize
+		if remaining := int64(size) - sum; remaining < int64(n) {
+			n = int(remaining)
+		}
+		sent, err := w.Write(payloadChunk(sum, n))
+		sum += int64(sent)
 		if err != nil {
-			logger.Error(errors.WrapIf(err, "could not send data"))
-			break
+			return sum, err
 		}
-		sum += sent
-		if uint(sum) >= request.PayloadSize {
+	}
+
+	return sum, nil
+}
+
+// payload returns n bytes of the payload pattern starting at the given offset
+func payload(offset int64, n int) []byte {
+	b := make([]byte, n)
+	fillPayload(b, offset)
+
+	return b
+}
+
+// payloadChunk returns at most tcpChunkSize bytes of the payload pattern starting
+// at the given offset without allocating, the returned slice must not be modified
+func payloadChunk(offset int64, n int) []byte {
+	start := int(offset % int64(len(payloadPattern)))
+
+	return payloadBuffer[start : start+n]
+}
+
+// fillPayload fills b with the payload pattern starting at the given offset
+func fillPayload(b []byte, offset int64) {
+	for i := 0; i < len(b); {
+		n := len(b) - i
+		if n > tcpChunkSize {
+			n = tcpChunkSize
+		}
+		i += copy(b[i:i+n], payloadChunk(offset+int64(i), n))
+	}
+}
+
+// idleTimeoutConn extends the deadline of the connection before every read and write,
+// so only a connection without progress times out
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (c idleTimeoutConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(b)
+}
+
+func (c idleTimeoutConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+func closeWrite(conn net.Conn) error {
+	if tc, ok := conn.(interface{ CloseWrite() error }); ok {
+		return tc.CloseWrite()
+	}
+
+	return nil
+}
+
+// parseSize parses a size with an optional unit suffix, e.g. 512, 10KiB, 1MB
+func parseSize(s string) (uint, error) {
+	units := []struct {
+		suffix     string
+		multiplier uint64
+	}{
+		{"KiB", 1 << 10},
+		{"MiB", 1 << 20},
+		{"GiB", 1 << 30},
+		{"KB", 1000},
+		{"MB", 1000 * 1000},
+		{"GB", 1000 * 1000 * 1000},
+		{"K", 1 << 10},
+		{"M", 1 << 20},
+		{"G", 1 << 30},
+		{"B", 1},
+	}
+
+	multiplier := uint64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSuffix(s, unit.suffix)
+			multiplier = unit.multiplier
 			break
 		}
 	}
-	logger.WithField("bytes", sum).Info("data sent")
+
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, errors.WrapIf(err, "could not parse size")
+	}
+	if v > math.MaxUint/multiplier {
+		return 0, errors.New("size is too large")
+	}
+
+	return uint(v * multiplier), nil
 }
@@ -0,0 +1,169 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/google/uuid"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Incoming holds the data of the incoming request which triggers the requests
+type Incoming struct {
+	Headers http.Header
+	// Path is the URL path of HTTP requests and the full method name of GRPC requests
+	Path string
+	// Params are the path parameters of the HTTP endpoint, e.g. /users/:id
+	Params map[string]string
+}
+
+// templateData is available to the templates of the requests
+type templateData struct {
+	Incoming
+
+	// Counter is the number of times the request has been sent, including the current one
+	Counter uint64
+}
+
+func (d templateData) Header(name string) string {
+	return d.Headers.Get(name)
+}
+
+func (d templateData) Param(name string) string {
+	return d.Params[name]
+}
+
+// nolint: gochecknoglobals
+var templateFuncs = template.FuncMap{
+	// rand returns a random number between min and max, inclusive
+	"rand": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		// nolint:gosec
+		return min + rand.Intn(max-min+1)
+	},
+	// randString returns a random alphanumeric string of length n
+	"randString": func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			// nolint:gosec
+			b.WriteByte(randomStringLetters[rand.Intn(len(randomStringLetters))])
+		}
+		return b.String()
+	},
+	"uuid": func() string {
+		return uuid.New().String()
+	},
+	"env": os.Getenv,
+}
+
+// isTemplate returns whether the text has template actions
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+// parseTemplate parses the text as a template, returns nil if the text has no template actions
+func parseTemplate(name string, text string) (*template.Template, error) {
+	if !isTemplate(text) {
+		return nil, nil
+	}
+
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, emperror.With(errors.WrapIf(err, "could not parse template"), "template", text)
+	}
+
+	return t, nil
+}
+
+// renderTemplate executes the template, returns the text unchanged if it is not a template
+func renderTemplate(t *template.Template, text string, data templateData) (string, error) {
+	if t == nil {
+		return text, nil
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", emperror.With(errors.WrapIf(err, "could not render template"), "template", text)
+	}
+
+	return b.String(), nil
+}
+
+// renderSample renders the text with empty incoming request data, so that
+// templated definitions can be validated when they are created
+func renderSample(text string) (string, error) {
+	t, err := parseTemplate("sample", text)
+	if err != nil {
+		return "", err
+	}
+
+	return renderTemplate(t, text, templateData{})
+}
+
+// counter counts the requests sent from the same definition
+type counter struct {
+	n uint64
+}
+
+func (c *counter) next() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	return atomic.AddUint64(&c.n, 1)
+}
+
+// incomingRequest is implemented by requests which use the data of the incoming request
+type incomingRequest interface {
+	Request
+
+	doIncoming(incoming Incoming, logger log.Logger) error
+}
+
+// boundRequest is a request bound to the incoming request it is sent for
+type boundRequest struct {
+	incomingRequest
+
+	incoming Incoming
+}
+
+func (r boundRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	return r.doIncoming(r.incoming, logger)
+}
+
+// bind binds the request to the incoming request if it uses its data
+func bind(request Request, incoming Incoming) Request {
+	if r, ok := request.(incomingRequest); ok {
+		return boundRequest{
+			incomingRequest: r,
+			incoming:        incoming,
+		}
+	}
+
+	return request
+}
@@ -0,0 +1,257 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const (
+	// UDPMaxDatagramSize is the largest possible UDP payload over IPv4, shared by the client and the server
+	UDPMaxDatagramSize = 65507
+
+	// udpHeaderSize is the size of the sequence number and send timestamp prepended to every datagram
+	udpHeaderSize = 16
+)
+
+type UDPRequest struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	// Size is the size of every datagram in bytes, including the 16 bytes long header
+	Size uint `json:"size"`
+	// Datagrams is the number of datagrams sent by a single request
+	Datagrams uint `json:"datagrams"`
+	// Rate is the number of datagrams sent per second, 0 means as fast as possible
+	Rate uint `json:"rate"`
+	// Wait enables waiting for the replies to calculate loss and RTT
+	Wait bool `json:"wait"`
+	// Timeout is how long to wait for replies after the last datagram is sent
+	Timeout time.Duration `json:"timeout"`
+
+	count uint
+}
+
+// parseUDPOptions sets the datagram and reply options from the options of the request definition
+func (request *UDPRequest) parseUDPOptions(options url.Values) error {
+	var err error
+
+	request.Size = 64
+	if v := options.Get("size"); v != "" {
+		if request.Size, err = parseSize(v); err != nil {
+			return errors.WrapIf(err, "invalid size")
+		}
+	}
+	if request.Size < udpHeaderSize {
+		request.Size = udpHeaderSize
+	}
+	if request.Size > UDPMaxDatagramSize {
+		return emperror.With(errors.New("size is larger than the maximum datagram size"), "size", request.Size)
+	}
+
+	request.Datagrams = 1
+	if v := options.Get("datagrams"); v != "" {
+		datagrams, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || datagrams == 0 {
+			return emperror.With(errors.New("invalid datagrams"), "datagrams", v)
+		}
+		request.Datagrams = uint(datagrams)
+	}
+
+	if v := options.Get("rate"); v != "" {
+		rate, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return errors.WrapIf(err, "invalid rate")
+		}
+		request.Rate = uint(rate)
+	}
+
+	if v := options.Get("wait"); v != "" {
+		if request.Wait, err = strconv.ParseBool(v); err != nil {
+			return errors.WrapIf(err, "invalid wait")
+		}
+	}
+
+	request.Timeout = time.Second
+	if v := options.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return emperror.With(errors.New("invalid timeout"), "timeout", v)
+		}
+		request.Timeout = timeout
+	}
+
+	return nil
+}
+
+func (request UDPRequest) Count() uint {
+	return request.count
+}
+
+func (request UDPRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	logger = logger.WithFields(log.Fields{
+		"host": request.Host,
+		"port": request.Port,
+		"size": request.Size,
+	})
+
+	stats, err := request.do()
+	if err != nil {
+		logger.WithFields(stats.fields(request.Wait)).Error(err)
+		return err
+	}
+	logger.WithFields(stats.fields(request.Wait)).Info("datagrams sent")
+
+	return nil
+}
+
+type udpStats struct {
+	sent uint
+	// replies is the number of sent datagrams echoed back at least once
+	replies uint
+	// unmatched replies do not echo a sent datagram, e.g. workload responses
+	unmatched  uint
+	duplicates uint
+	rtts       []time.Duration
+	duration   time.Duration
+}
+
+func (s udpStats) fields(wait bool) log.Fields {
+	fields := log.Fields{
+		"datagrams": s.sent,
+		"duration":  s.duration,
+	}
+	if !wait || s.sent == 0 {
+		return fields
+	}
+
+	received := s.replies + s.unmatched
+	if received > s.sent {
+		received = s.sent
+	}
+	fields["replies"] = s.replies + s.unmatched
+	fields["loss"] = 1 - float64(received)/float64(s.sent)
+	if s.duplicates > 0 {
+		fields["duplicates"] = s.duplicates
+	}
+
+	for k, v := range durationFields("rtt", s.rtts) {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+func (request UDPRequest) do() (udpStats, error) {
+	var stats udpStats
+
+	conn, err := net.Dial("udp", net.JoinHostPort(request.Host, strconv.Itoa(request.Port)))
+	if err != nil {
+		return stats, errors.WrapIf(err, "could not connect")
+	}
+	defer conn.Close()
+
+	var mu sync.Mutex
+	sentAt := make([]time.Time, request.Datagrams)
+
+	replies := make(chan udpStats, 1)
+	if request.Wait {
+		go func() {
+			var r udpStats
+			seen := make([]bool, request.Datagrams)
+			buf := make([]byte, UDPMaxDatagramSize)
+			for r.replies+r.unmatched < request.Datagrams {
+				n, err := conn.Read(buf)
+				if err != nil {
+					break
+				}
+
+				// only the first echo of every sent datagram is counted, replies which do not
+				// echo the header are counted without RTT
+				if n < udpHeaderSize {
+					r.unmatched++
+					continue
+				}
+				seq := binary.BigEndian.Uint64(buf)
+				if seq >= uint64(request.Datagrams) {
+					r.unmatched++
+					continue
+				}
+				if seen[seq] {
+					r.duplicates++
+					continue
+				}
+				seen[seq] = true
+				r.replies++
+				mu.Lock()
+				r.rtts = append(r.rtts, time.Since(sentAt[seq]))
+				mu.Unlock()
+			}
+			replies <- r
+		}()
+	}
+
+	var interval time.Duration
+	if request.Rate > 0 {
+		interval = time.Second / time.Duration(request.Rate)
+	}
+
+	start := time.Now()
+	datagram := payload(0, int(request.Size))
+	for i := uint(0); i < request.Datagrams; i++ {
+		if i > 0 && interval > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(i) * interval)))
+		}
+
+		now := time.Now()
+		binary.BigEndian.PutUint64(datagram, uint64(i))
+		binary.BigEndian.PutUint64(datagram[8:], uint64(now.UnixNano()))
+
+		mu.Lock()
+		sentAt[i] = now
+		mu.Unlock()
+
+		if _, err := conn.Write(datagram); err != nil {
+			stats.duration = time.Since(start)
+			return stats, errors.WrapIf(err, "could not send datagram")
+		}
+		stats.sent++
+	}
+
+	if request.Wait {
+		if err := conn.SetReadDeadline(time.Now().Add(request.Timeout)); err != nil {
+			return stats, errors.WrapIf(err, "could not set read deadline")
+		}
+		r := <-replies
+		stats.replies = r.replies
+		stats.unmatched = r.unmatched
+		stats.duplicates = r.duplicates
+		stats.rtts = r.rtts
+	}
+	stats.duration = time.Since(start)
+
+	return stats, nil
+}
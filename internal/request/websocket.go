@@ -0,0 +1,243 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package request
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+const (
+	// WebSocketModeEcho sends the messages and waits for each of them to be echoed back
+	WebSocketModeEcho = "echo"
+	// WebSocketModeStream only receives the messages streamed by the server
+	WebSocketModeStream = "stream"
+
+	websocketCloseTimeout = time.Second
+	// websocketDefaultTimeout is the default limit of the handshake and of waiting for a message
+	websocketDefaultTimeout = 30 * time.Second
+)
+
+type WebSocketRequest struct {
+	URL string `json:"url"`
+
+	// Mode is one of echo or stream
+	Mode string `json:"mode"`
+	// Messages is the number of messages exchanged on the connection
+	Messages uint `json:"messages"`
+	// Size is the size of every sent message in bytes
+	Size uint `json:"size"`
+	// Interval is the delay between the sent messages
+	Interval time.Duration `json:"interval"`
+	// Timeout limits the handshake and the wait for every message
+	Timeout time.Duration `json:"timeout"`
+
+	proxy *proxyDialer
+	count uint
+}
+
+// parseWebSocketOptions sets the message options from the options of the request definition
+func (request *WebSocketRequest) parseWebSocketOptions(options url.Values) error {
+	var err error
+
+	request.Mode = WebSocketModeEcho
+	if v := options.Get("mode"); v != "" {
+		switch v {
+		case WebSocketModeEcho, WebSocketModeStream:
+			request.Mode = v
+		default:
+			return emperror.With(errors.New("invalid mode"), "mode", v)
+		}
+	}
+
+	request.Messages = 1
+	if v := options.Get("messages"); v != "" {
+		messages, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || messages == 0 {
+			return emperror.With(errors.New("invalid messages"), "messages", v)
+		}
+		request.Messages = uint(messages)
+	}
+
+	request.Size = 64
+	if v := options.Get("size"); v != "" {
+		if request.Size, err = parseSize(v); err != nil {
+			return errors.WrapIf(err, "invalid size")
+		}
+	}
+
+	if v := options.Get("interval"); v != "" {
+		if request.Interval, err = time.ParseDuration(v); err != nil {
+			return errors.WrapIf(err, "invalid interval")
+		}
+	}
+
+	request.Timeout = websocketDefaultTimeout
+	if v := options.Get("timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return emperror.With(errors.New("invalid timeout"), "timeout", v)
+		}
+		request.Timeout = timeout
+	}
+
+	return nil
+}
+
+func (request WebSocketRequest) Count() uint {
+	return request.count
+}
+
+func (request WebSocketRequest) Do(incomingRequestHeaders http.Header, logger log.Logger) error {
+	correlationID := uuid.New()
+	logger = logger.WithFields(log.Fields{
+		"url":           request.URL,
+		"mode":          request.Mode,
+		"correlationID": correlationID,
+	})
+	logger.Info("outgoing request")
+
+	headers := make(http.Header)
+	for _, header := range headersToPropagate {
+		if val := incomingRequestHeaders.Get(header); val != "" {
+			headers.Set(header, val)
+		}
+	}
+
+	start := time.Now()
+	conn, resp, err := request.dialer().Dial(request.URL, headers)
+	if err != nil {
+		if resp != nil {
+			logger = logger.WithField("statusCode", resp.StatusCode)
+		}
+		err = errors.WrapIf(err, "could not open connection")
+		logger.Error(err)
+		return err
+	}
+	defer conn.Close()
+	handshake := time.Since(start)
+
+	var latencies []time.Duration
+	switch request.Mode {
+	case WebSocketModeStream:
+		latencies, err = request.stream(conn)
+	default:
+		latencies, err = request.echo(conn)
+	}
+
+	fields := durationFields("latency", latencies)
+	fields["handshake"] = handshake
+	fields["messages"] = len(latencies)
+	fields["duration"] = time.Since(start)
+	logger = logger.WithFields(fields)
+
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(websocketCloseTimeout)); err != nil {
+		err = errors.WrapIf(err, "could not close connection")
+		logger.Error(err)
+		return err
+	}
+
+	logger.Info("response to outgoing request")
+
+	return nil
+}
+
+// dialer creates the dialer of the connection, which uses the proxy of the request
+// instead of the proxy environment variables like the default dialer
+func (request WebSocketRequest) dialer() *websocket.Dialer {
+	// the proxy is selected by the scheme of the handshake request
+	scheme := "http"
+	if u, err := url.Parse(request.URL); err == nil && u.Scheme == "wss" {
+		scheme = "https"
+	}
+
+	return &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return request.proxy.dial(ctx, scheme, addr)
+		},
+		HandshakeTimeout: request.Timeout,
+	}
+}
+
+// echo sends the messages one by one and verifies that each one is echoed back
+func (request WebSocketRequest) echo(conn *websocket.Conn) ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, request.Messages)
+	message := payload(0, int(request.Size))
+	for i := uint(0); i < request.Messages; i++ {
+		if i > 0 && request.Interval > 0 {
+			time.Sleep(request.Interval)
+		}
+
+		start := time.Now()
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			return latencies, errors.WrapIf(err, "could not send message")
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(request.Timeout)); err != nil {
+			return latencies, errors.WrapIf(err, "could not set read deadline")
+		}
+		_, response, err := conn.ReadMessage()
+		if err != nil {
+			return latencies, errors.WrapIf(err, "could not receive message")
+		}
+		latencies = append(latencies, time.Since(start))
+
+		if !bytes.Equal(response, message) {
+			return latencies, emperror.With(errors.New("echoed message does not match"), "message", i)
+		}
+	}
+
+	return latencies, nil
+}
+
+// stream receives the messages sent by the server, the latency of a message is
+// the time elapsed since the previous one
+func (request WebSocketRequest) stream(conn *websocket.Conn) ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, request.Messages)
+	last := time.Now()
+	for i := uint(0); i < request.Messages; i++ {
+		if err := conn.SetReadDeadline(time.Now().Add(request.Timeout)); err != nil {
+			return latencies, errors.WrapIf(err, "could not set read deadline")
+		}
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return latencies, emperror.With(errors.New("connection closed by the server"), "expected", request.Messages)
+			}
+			return latencies, errors.WrapIf(err, "could not receive message")
+		}
+		now := time.Now()
+		latencies = append(latencies, now.Sub(last))
+		last = now
+	}
+
+	return latencies, nil
+}
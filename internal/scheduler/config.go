@@ -0,0 +1,61 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/robfig/cron/v3"
+)
+
+type Config struct {
+	// Interval is the delay between the triggers
+	Interval time.Duration `mapstructure:"interval"`
+	// Cron is a standard cron expression, e.g. "*/5 * * * *"
+	Cron string `mapstructure:"cron"`
+	// Jitter is the upper bound of the random delay added to every trigger
+	Jitter time.Duration `mapstructure:"jitter"`
+}
+
+// Enabled returns whether a schedule is configured
+func (c Config) Enabled() bool {
+	return c.Interval > 0 || c.Cron != ""
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.Interval < 0 || c.Jitter < 0 {
+		return c, errors.New("interval and jitter must not be negative")
+	}
+
+	if c.Interval > 0 && c.Cron != "" {
+		return c, errors.New("interval and cron are mutually exclusive")
+	}
+
+	if c.Cron != "" {
+		schedule, err := cron.ParseStandard(c.Cron)
+		if err != nil {
+			return c, emperror.With(errors.WrapIf(err, "invalid cron expression"), "cron", c.Cron)
+		}
+		// e.g. "0 0 30 2 *" is valid but never activated
+		if schedule.Next(time.Now()).IsZero() {
+			return c, emperror.With(errors.New("cron expression never fires"), "cron", c.Cron)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,206 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	"github.com/robfig/cron/v3"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+	"github.com/banzaicloud/allspark/internal/sql"
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+// maxInFlightTriggers bounds the triggers running at the same time when the
+// requests are slower than the schedule, the triggers over it are skipped
+const maxInFlightTriggers = 16
+
+// Scheduler triggers the requests, the SQL query and the workload periodically
+// as if an inbound request had arrived
+type Scheduler struct {
+	requests request.Requests
+	workload workload.Workload
+
+	sqlCient *sql.Client
+
+	schedule cron.Schedule
+	jitter   time.Duration
+	limiter  *limiter.Limiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	errorHandler emperror.Handler
+	logger       log.Logger
+}
+
+func New(config Config, logger log.Logger, errorHandler emperror.Handler) (*Scheduler, error) {
+	logger = logger.WithField("server", "scheduler")
+
+	var schedule cron.Schedule = interval(config.Interval)
+	if config.Cron != "" {
+		var err error
+		if schedule, err = cron.ParseStandard(config.Cron); err != nil {
+			return nil, errors.WrapIf(err, "invalid cron expression")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		requests: make(request.Requests, 0),
+
+		schedule: schedule,
+		jitter:   config.Jitter,
+		limiter:  limiter.New(limiter.Config{MaxInFlight: maxInFlightTriggers}),
+
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		errorHandler: errorHandler,
+		logger:       logger,
+	}, nil
+}
+
+// interval is a schedule with a fixed delay, unlike cron.Every it is not
+// rounded to seconds
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+func (s *Scheduler) SetWorkload(workload workload.Workload) {
+	s.logger.WithField("name", workload.GetName()).Info("set workload")
+	s.workload = workload
+}
+
+func (s *Scheduler) SetRequests(requests request.Requests) {
+	s.requests = requests
+}
+
+func (s *Scheduler) SetSQLClient(client *sql.Client) {
+	s.sqlCient = client
+}
+
+func (s *Scheduler) Run() {
+	defer close(s.done)
+
+	s.logger.WithField("jitter", s.jitter).Info("starting scheduler")
+
+	for {
+		next := s.schedule.Next(time.Now())
+		// a cron schedule without any further activation would be a busy loop
+		if next.IsZero() {
+			s.errorHandler.Handle(errors.New("schedule has no further triggers"))
+			return
+		}
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter)))) // nolint:gosec
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		release, err := s.limiter.Acquire()
+		if err != nil {
+			s.logger.WithField("error", err.Error()).Warn("trigger skipped")
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer release()
+			s.trigger()
+		}()
+	}
+}
+
+// Shutdown stops the scheduling and waits for the triggered requests to finish
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down scheduler")
+
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		<-s.done
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.WrapIf(ctx.Err(), "could not wait for the triggered requests")
+	}
+}
+
+func (s *Scheduler) trigger() {
+	s.logger.Info("scheduled trigger")
+
+	s.doRequests(nil)
+
+	if s.sqlCient != nil {
+		go func() {
+			query, err := s.sqlCient.RunQuery(s.logger)
+			if err != nil {
+				s.logger.WithFields(log.Fields{
+					"query": query,
+				}).Error(err)
+			}
+		}()
+	}
+
+	if s.workload != nil {
+		if _, _, err := s.workload.Execute(); err != nil && !errors.Is(err, workload.ErrNoWorkload) {
+			s.errorHandler.Handle(errors.WrapIf(err, "could not run workload"))
+		}
+	}
+}
+
+func (s *Scheduler) doRequests(incomingRequestHeaders http.Header) {
+	var wg sync.WaitGroup
+
+	// path conditions never match as there is no incoming path
+	for _, r := range s.requests.Select(request.Incoming{Headers: incomingRequestHeaders}) {
+		var i uint
+		for i = 0; i < r.Count(); i++ {
+			wg.Add(1)
+			go func(request request.Request) {
+				defer wg.Done()
+				request.Do(incomingRequestHeaders, s.logger)
+			}(r)
+		}
+	}
+
+	wg.Wait()
+}
@@ -15,10 +15,12 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math/rand"
 	"net/url"
+	"sync"
 	"time"
 
 	"emperror.dev/errors"
@@ -42,6 +44,7 @@ type Client struct {
 	sqlQueryRepeatCount    int
 	sqlQueryRepeatCountMax int
 
+	mu   sync.Mutex
 	conn *sql.DB
 }
 
@@ -81,16 +84,41 @@ func (c *Client) GetDriver() string {
 	return c.driver
 }
 
-func (c *Client) RunQuery(logger log.Logger) (string, error) {
-	var err error
+func (c *Client) connect() (*sql.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	if c.conn == nil {
-		c.conn, err = sql.Open(c.driver, c.dsn)
+		conn, err := sql.Open(c.driver, c.dsn)
 		if err != nil {
-			return c.query, fmt.Errorf("unable to connect to database: %v", err)
+			return nil, fmt.Errorf("unable to connect to database: %v", err)
 		}
-		c.conn.SetMaxOpenConns(50)
-		c.conn.SetMaxIdleConns(25)
+		conn.SetMaxOpenConns(50)
+		conn.SetMaxIdleConns(25)
+		c.conn = conn
+	}
+
+	return c.conn, nil
+}
+
+// Ping verifies that the database is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	if err := conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping failed: %v", err)
+	}
+
+	return nil
+}
+
+func (c *Client) RunQuery(logger log.Logger) (string, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return c.query, err
 	}
 
 	var count int
@@ -104,7 +132,7 @@ func (c *Client) RunQuery(logger log.Logger) (string, error) {
 	}).Info("outgoing query")
 
 	for i := 0; i < count; i++ {
-		rows, err := c.conn.Query(c.query)
+		rows, err := conn.Query(c.query)
 		if err != nil {
 			return c.query, fmt.Errorf("query failed: %v", err)
 		}
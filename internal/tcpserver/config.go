@@ -14,8 +14,37 @@
 
 package tcpserver
 
+import (
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+	"github.com/banzaicloud/allspark/internal/request"
+)
+
+const (
+	// ModeSink reads everything until the client closes the connection and never responds
+	ModeSink = "sink"
+	// ModeEcho writes every received byte back
+	ModeEcho = "echo"
+	// ModeWorkload responds with the output of the workload
+	ModeWorkload = "workload"
+	// ModeFramed reads length-prefixed frames and responds to each one with the same payload
+	ModeFramed = "framed"
+)
+
 type Config struct {
 	ListenAddress string `mapstructure:"listenAddress"`
+
+	// Mode is how the server responds to the incoming connections
+	// Accepted values are: sink, echo, workload, framed
+	Mode string `mapstructure:"mode"`
+
+	// MaxFrameSize limits the payload size of a frame in framed mode
+	MaxFrameSize uint32 `mapstructure:"maxFrameSize"`
+
+	// Limits are the rate and concurrency limits of the incoming requests
+	Limits limiter.Config `mapstructure:"limits"`
 }
 
 // Validate checks that the configuration is valid.
@@ -24,5 +53,25 @@ func (c Config) Validate() (Config, error) {
 		c.ListenAddress = "0.0.0.0:8083"
 	}
 
+	if c.Mode == "" {
+		c.Mode = ModeSink
+	}
+
+	switch c.Mode {
+	case ModeSink, ModeEcho, ModeWorkload, ModeFramed:
+	default:
+		return c, emperror.With(errors.New("invalid TCP server mode"), "mode", c.Mode)
+	}
+
+	if c.MaxFrameSize == 0 {
+		c.MaxFrameSize = request.TCPDefaultMaxFrameSize
+	}
+
+	limits, err := c.Limits.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "invalid limits")
+	}
+	c.Limits = limits
+
 	return c, nil
 }
@@ -0,0 +1,167 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcpserver
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+// frameHeaderSize is the size of the big-endian payload length preceding every frame
+const frameHeaderSize = 4
+
+func (s *Server) sink(c net.Conn, requests *sync.WaitGroup) {
+	s.goRequests(requests)
+	s.runSQLQuery()
+
+	tmp := make([]byte, 4096)
+	for {
+		_, err := c.Read(tmp)
+		if err != nil {
+			break
+		}
+	}
+
+	s.runWorkload()
+}
+
+func (s *Server) echo(c net.Conn, requests *sync.WaitGroup) {
+	s.goRequests(requests)
+	s.runSQLQuery()
+	s.runWorkload()
+
+	n, err := io.Copy(c, c)
+	if err != nil {
+		s.logger.WithField("bytes", n).Error(errors.WrapIf(err, "could not echo data"))
+		return
+	}
+	s.logger.WithField("bytes", n).Info("data echoed")
+}
+
+func (s *Server) respondWithWorkload(c net.Conn) {
+	s.doRequests(nil)
+	s.runSQLQuery()
+
+	response := s.runWorkload()
+	if _, err := c.Write([]byte(response)); err != nil {
+		s.logger.Error(errors.WrapIf(err, "could not send response"))
+		return
+	}
+
+	// let the client know the response is complete and wait for it to close the connection
+	if tc, ok := c.(*net.TCPConn); ok {
+		tc.CloseWrite() // nolint:errcheck
+	}
+	io.Copy(io.Discard, c) // nolint:errcheck
+}
+
+func (s *Server) framed(c net.Conn) {
+	var frames int
+	for {
+		payload, err := readFrame(c, s.maxFrameSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.logger.Error(errors.WrapIf(err, "could not read frame"))
+			return
+		}
+		frames++
+
+		s.doRequests(nil)
+		s.runSQLQuery()
+		s.runWorkload()
+
+		if err := writeFrame(c, payload); err != nil {
+			s.logger.Error(errors.WrapIf(err, "could not write frame"))
+			return
+		}
+	}
+	s.logger.WithField("frames", frames).Info("framed connection finished")
+}
+
+func readFrame(r io.Reader, maxSize uint32) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxSize {
+		return nil, emperror.With(errors.New("frame too large"), "size", size, "maxSize", maxSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.WrapIf(err, "could not read frame payload")
+	}
+
+	return payload, nil
+}
+
+func writeFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+
+	_, err := w.Write(frame)
+
+	return err
+}
+
+// goRequests sends the subsequent requests in the background while the connection is handled
+func (s *Server) goRequests(requests *sync.WaitGroup) {
+	requests.Add(1)
+	go func() {
+		defer requests.Done()
+		s.doRequests(nil)
+	}()
+}
+
+func (s *Server) runSQLQuery() {
+	if s.sqlCient == nil {
+		return
+	}
+
+	go func() {
+		query, err := s.sqlCient.RunQuery(s.logger)
+		if err != nil {
+			s.logger.WithFields(log.Fields{
+				"query": query,
+			}).Error(err)
+		}
+	}()
+}
+
+func (s *Server) runWorkload() string {
+	if s.workload == nil {
+		return ""
+	}
+
+	response, _, err := s.workload.Execute()
+	if err != nil && !errors.Is(err, workload.ErrNoWorkload) {
+		s.errorHandler.Handle(errors.WrapIf(err, "could not run workload"))
+	}
+
+	return response
+}
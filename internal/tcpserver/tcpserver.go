@@ -15,25 +15,41 @@
 package tcpserver
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"emperror.dev/emperror"
 	"emperror.dev/errors"
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/limiter"
 	"github.com/banzaicloud/allspark/internal/platform/log"
 	"github.com/banzaicloud/allspark/internal/request"
 	"github.com/banzaicloud/allspark/internal/sql"
 	"github.com/banzaicloud/allspark/internal/workload"
 )
 
+const shutdownPollInterval = 100 * time.Millisecond
+
 type Server struct {
 	requests request.Requests
 	workload workload.Workload
 
 	sqlCient *sql.Client
 
+	faultInjector *fault.Injector
+	limiter       *limiter.Limiter
+
 	listenAddress string
+	mode          string
+	maxFrameSize  uint32
+
+	mu          sync.Mutex
+	listener    net.Listener
+	connections map[net.Conn]struct{}
+	inShutdown  bool
 
 	errorHandler emperror.Handler
 	logger       log.Logger
@@ -45,6 +61,11 @@ func New(config Config, logger log.Logger, errorHandler emperror.Handler) *Serve
 		requests: make(request.Requests, 0),
 
 		listenAddress: config.ListenAddress,
+		mode:          config.Mode,
+		maxFrameSize:  config.MaxFrameSize,
+		limiter:       limiter.New(config.Limits),
+
+		connections: make(map[net.Conn]struct{}),
 
 		errorHandler: errorHandler,
 		logger:       logger,
@@ -64,65 +85,162 @@ func (s *Server) SetSQLClient(client *sql.Client) {
 	s.sqlCient = client
 }
 
+func (s *Server) SetFaultInjector(injector *fault.Injector) {
+	s.faultInjector = injector
+}
+
 func (s *Server) Run() {
 	lis, err := net.Listen("tcp", s.listenAddress)
 	if err != nil {
 		s.errorHandler.Handle(errors.WrapIf(err, "could not listen"))
 		return
 	}
-	s.logger.WithField("address", s.listenAddress).Info("starting TCP server")
+
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		lis.Close()
+		return
+	}
+	s.listener = lis
+	s.mu.Unlock()
+
+	s.logger.WithFields(log.Fields{
+		"address": s.listenAddress,
+		"mode":    s.mode,
+	}).Info("starting TCP server")
 
 	for {
 		c, err := lis.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) && s.shuttingDown() {
+				return
+			}
 			s.errorHandler.Handle(errors.WrapIf(err, "could not accept connection"))
 			return
 		}
-		go s.Incoming(c)
+		if !s.trackConnection(c, true) {
+			c.Close()
+			continue
+		}
+		release, err := s.limiter.Acquire()
+		if err != nil {
+			s.logger.WithFields(log.Fields{
+				"remoteAddress": c.RemoteAddr().String(),
+				"error":         err.Error(),
+			}).Debug("connection rejected")
+			c.Close()
+			s.trackConnection(c, false)
+			continue
+		}
+		go func() {
+			defer s.trackConnection(c, false)
+			defer release()
+			s.Incoming(c)
+		}()
 	}
 }
 
-func (s *Server) Incoming(c net.Conn) {
-	s.logger.Info("incoming TCP request")
-	defer func() {
-		c.Close()
-	}()
+// Shutdown stops accepting new connections and waits for the active ones to
+// be finished, closing the remaining connections when the context expires
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down TCP server")
 
-	go s.doRequests(nil)
-
-	if s.sqlCient != nil {
-		go func() {
-			query, err := s.sqlCient.RunQuery(s.logger)
-			if err != nil {
-				s.logger.WithFields(log.Fields{
-					"query": query,
-				}).Error(err)
-			}
-		}()
+	var err error
+	s.mu.Lock()
+	s.inShutdown = true
+	if s.listener != nil {
+		err = s.listener.Close()
 	}
+	s.mu.Unlock()
 
-	tmp := make([]byte, 4096)
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
 	for {
-		_, err := c.Read(tmp)
-		if err != nil {
-			break
+		if s.activeConnections() == 0 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConnections()
+			return errors.WrapIf(ctx.Err(), "could not drain TCP connections")
+		case <-ticker.C:
 		}
 	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inShutdown
+}
+
+func (s *Server) trackConnection(c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if add {
+		if s.inShutdown {
+			return false
+		}
+		s.connections[c] = struct{}{}
+	} else {
+		delete(s.connections, c)
+	}
+
+	return true
+}
+
+func (s *Server) activeConnections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.connections)
+}
 
-	if s.workload == nil {
+func (s *Server) closeConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.connections {
+		c.Close()
+	}
+}
+
+func (s *Server) Incoming(c net.Conn) {
+	s.logger.Info("incoming TCP request")
+
+	// the subsequent requests sent in the background are waited for after the connection
+	// is closed, so they are bounded by the limits of the connection
+	var requests sync.WaitGroup
+	defer requests.Wait()
+	defer func() {
+		c.Close()
+	}()
+
+	if err := s.faultInjector.Inject(context.Background()); err != nil {
+		s.logger.WithField("error", err.Error()).Warn("fault injected")
 		return
 	}
 
-	_, _, err := s.workload.Execute()
-	if err != nil {
-		s.errorHandler.Handle(errors.WrapIf(err, "could not run workload"))
+	switch s.mode {
+	case ModeEcho:
+		s.echo(c, &requests)
+	case ModeWorkload:
+		s.respondWithWorkload(c)
+	case ModeFramed:
+		s.framed(c)
+	default:
+		s.sink(c, &requests)
 	}
 }
 
 func (s *Server) doRequests(incomingRequestHeaders http.Header) {
 	var wg sync.WaitGroup
 
-	for _, r := range s.requests {
+	// path conditions never match as there is no incoming path
+	for _, r := range s.requests.Select(request.Incoming{Headers: incomingRequestHeaders}) {
 		var i uint
 		for i = 0; i < r.Count(); i++ {
 			wg.Add(1)
@@ -0,0 +1,43 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topology
+
+import (
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+)
+
+type Config struct {
+	// File is the path of the topology file
+	File string `mapstructure:"file"`
+	// Service is the name of the service to run, it is resolved from the
+	// SERVICE_NAME and POD_NAME environment variables if not set
+	Service string `mapstructure:"service"`
+	// BasePort is the first port allocated to the services by the simulate command
+	BasePort int `mapstructure:"basePort"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.BasePort == 0 {
+		c.BasePort = 9000
+	}
+
+	if c.BasePort < 1 || c.BasePort > 65535 {
+		return c, emperror.With(errors.New("invalid base port"), "basePort", c.BasePort)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,320 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topology
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+const (
+	ProtocolHTTP      = "http"
+	ProtocolWebSocket = "ws"
+	ProtocolGRPC      = "grpc"
+	ProtocolTCP       = "tcp"
+	ProtocolUDP       = "udp"
+)
+
+// DefaultPorts are the default ports of the servers
+// nolint: gochecknoglobals
+var DefaultPorts = map[string]int{
+	ProtocolHTTP: 8080,
+	ProtocolGRPC: 8082,
+	ProtocolTCP:  8083,
+	ProtocolUDP:  8084,
+}
+
+// Topology describes a set of services and the calls between them
+type Topology struct {
+	Services map[string]Service `yaml:"services"`
+}
+
+type Service struct {
+	// Host is the address of the service, defaults to the name of the service
+	Host string `yaml:"host"`
+	// Protocols are the protocols served by the service, defaults to http
+	// Accepted values are: http, grpc, tcp, udp
+	Protocols []string `yaml:"protocols"`
+	// Ports overrides the default ports of the protocols
+	Ports map[string]int `yaml:"ports"`
+
+	Workload workload.Config `yaml:"workload"`
+
+	// Calls are the requests sent on every incoming request
+	Calls []Call `yaml:"calls"`
+}
+
+// Call is a request to another service of the topology, or to an arbitrary URL
+type Call struct {
+	Service string `yaml:"service"`
+	// Protocol is the protocol of the call, defaults to http
+	// Accepted values are: http, ws, grpc, tcp, udp
+	Protocol string `yaml:"protocol"`
+	// Path defaults to / on http, /ws on ws and /allspark/Incoming on grpc
+	Path string `yaml:"path"`
+
+	// URL is an arbitrary URL called instead of a service
+	URL string `yaml:"url"`
+
+	// Count defaults to 1
+	Count uint `yaml:"count"`
+	// Options are the URL encoded request options, e.g. protocol=h2c or size=1KiB&mode=echo
+	Options string `yaml:"options"`
+}
+
+// Load reads and validates a topology file
+func Load(path string) (Topology, error) {
+	var t Topology
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return t, errors.WrapIf(err, "could not read topology file")
+	}
+
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return t, errors.WrapIf(err, "could not parse topology file")
+	}
+
+	return t, t.Validate()
+}
+
+// Validate checks that the calls reference existing services and protocols
+func (t Topology) Validate() error {
+	for _, name := range t.ServiceNames() {
+		service := t.Services[name]
+		for _, protocol := range service.protocols() {
+			if _, ok := DefaultPorts[protocol]; !ok {
+				return emperror.With(errors.New("invalid protocol"), "service", name, "protocol", protocol)
+			}
+		}
+
+		for i, call := range service.Calls {
+			if err := t.validateCall(call); err != nil {
+				return emperror.With(err, "service", name, "call", i)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t Topology) validateCall(call Call) error {
+	if (call.URL == "") == (call.Service == "") {
+		return errors.New("exactly one of url and service must be set")
+	}
+
+	if call.URL != "" {
+		return nil
+	}
+
+	target, ok := t.Services[call.Service]
+	if !ok {
+		return emperror.With(errors.New("unknown service"), "target", call.Service)
+	}
+
+	protocol := call.protocol()
+	served := protocol
+	if protocol == ProtocolWebSocket {
+		served = ProtocolHTTP
+	}
+	if !target.Serves(served) {
+		return emperror.With(errors.New("protocol is not served by the service"), "target", call.Service, "protocol", protocol)
+	}
+
+	return nil
+}
+
+// ServiceNames returns the names of the services in alphabetical order
+func (t Topology) ServiceNames() []string {
+	names := make([]string, 0, len(t.Services))
+	for name := range t.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Lookup finds the service by the first matching candidate name, a candidate
+// also matches when it is a pod name created for the service, e.g.
+// frontend-7d9f8b6c4-x2x4z or frontend-0
+func (t Topology) Lookup(candidates ...string) (string, Service, error) {
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+
+		name := candidate
+		for {
+			if service, ok := t.Services[name]; ok {
+				return name, service, nil
+			}
+			i := strings.LastIndex(name, "-")
+			if i < 0 {
+				break
+			}
+			name = name[:i]
+		}
+	}
+
+	return "", Service{}, emperror.With(errors.New("service not found in topology"), "candidates", candidates)
+}
+
+// Local returns a copy of the topology with every service on the given host
+// and on distinct ports allocated from the base port, in the order of the
+// service names and protocols, so that all services can run in one process,
+// it returns an error if the allocated ports do not fit below 65536
+func (t Topology) Local(host string, basePort int) (Topology, error) {
+	local := Topology{
+		Services: make(map[string]Service, len(t.Services)),
+	}
+
+	port := basePort
+	for _, name := range t.ServiceNames() {
+		service := t.Services[name]
+		service.Host = host
+		service.Ports = make(map[string]int)
+		for _, protocol := range []string{ProtocolHTTP, ProtocolGRPC, ProtocolTCP, ProtocolUDP} {
+			if service.Serves(protocol) {
+				if port > 65535 {
+					return local, emperror.With(errors.New("allocated port exceeds 65535"), "service", name, "protocol", protocol, "basePort", basePort)
+				}
+				service.Ports[protocol] = port
+				port++
+			}
+		}
+		local.Services[name] = service
+	}
+
+	return local, nil
+}
+
+// Requests returns the request definitions of the calls of the service
+func (t Topology) Requests(service Service) ([]string, error) {
+	requests := make([]string, 0, len(service.Calls))
+	for _, call := range service.Calls {
+		definition, err := t.definition(call)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, definition)
+	}
+
+	return requests, nil
+}
+
+// definition creates the request definition of a call in the URL#count#options format
+func (t Topology) definition(call Call) (string, error) {
+	if err := t.validateCall(call); err != nil {
+		return "", err
+	}
+
+	url := call.URL
+	if url == "" {
+		target := t.Services[call.Service]
+		protocol := call.protocol()
+
+		port := target.Port(protocol)
+		if protocol == ProtocolWebSocket {
+			port = target.Port(ProtocolHTTP)
+		}
+		address := net.JoinHostPort(target.host(call.Service), strconv.Itoa(port))
+
+		url = fmt.Sprintf("%s://%s%s", protocol, address, call.path())
+	}
+
+	count := call.Count
+	if count == 0 {
+		count = 1
+	}
+
+	definition := fmt.Sprintf("%s#%d", url, count)
+	if call.Options != "" {
+		definition += "#" + call.Options
+	}
+
+	return definition, nil
+}
+
+func (c Call) protocol() string {
+	if c.Protocol == "" {
+		return ProtocolHTTP
+	}
+
+	return c.Protocol
+}
+
+func (c Call) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+
+	switch c.protocol() {
+	case ProtocolHTTP:
+		return "/"
+	case ProtocolWebSocket:
+		return "/ws"
+	case ProtocolGRPC:
+		return "/allspark/Incoming"
+	default:
+		return ""
+	}
+}
+
+// Serves returns whether the service serves the protocol
+func (s Service) Serves(protocol string) bool {
+	for _, p := range s.protocols() {
+		if p == protocol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Port returns the port of the protocol
+func (s Service) Port(protocol string) int {
+	if port, ok := s.Ports[protocol]; ok {
+		return port
+	}
+
+	return DefaultPorts[protocol]
+}
+
+func (s Service) protocols() []string {
+	if len(s.Protocols) == 0 {
+		return []string{ProtocolHTTP}
+	}
+
+	return s.Protocols
+}
+
+func (s Service) host(name string) string {
+	if s.Host != "" {
+		return s.Host
+	}
+
+	return name
+}
@@ -0,0 +1,197 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topology
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	topology := Topology{
+		Services: map[string]Service{
+			"frontend":     {},
+			"user":         {},
+			"user-api":     {Protocols: []string{ProtocolGRPC}},
+			"user-api-db":  {Protocols: []string{ProtocolTCP}},
+			"payment-0":    {},
+			"notification": {},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+		wantErr    bool
+	}{
+		{name: "exact name", candidates: []string{"frontend"}, want: "frontend"},
+		{name: "deployment pod name", candidates: []string{"frontend-7d9f8b6c4-x2x4z"}, want: "frontend"},
+		{name: "statefulset pod name", candidates: []string{"notification-0"}, want: "notification"},
+		{name: "longest hyphenated name wins", candidates: []string{"user-api-5f6d7c8b9-abcde"}, want: "user-api"},
+		{name: "hyphenated exact name", candidates: []string{"user-api-db"}, want: "user-api-db"},
+		{name: "name ending with a number", candidates: []string{"payment-0"}, want: "payment-0"},
+		{name: "empty candidates are skipped", candidates: []string{"", "frontend-0"}, want: "frontend"},
+		{name: "first matching candidate wins", candidates: []string{"unknown-0", "user-1", "frontend"}, want: "user"},
+		{name: "prefix of a name does not match", candidates: []string{"front"}, wantErr: true},
+		{name: "no candidates", wantErr: true},
+		{name: "no match", candidates: []string{"backend-7d9f8b6c4-x2x4z", ""}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			name, service, err := topology.Lookup(test.candidates...)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got service %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != test.want {
+				t.Errorf("got service %q, want %q", name, test.want)
+			}
+			if !reflect.DeepEqual(service, topology.Services[test.want]) {
+				t.Errorf("got service %+v, want %+v", service, topology.Services[test.want])
+			}
+		})
+	}
+}
+
+func TestLocal(t *testing.T) {
+	topology := Topology{
+		Services: map[string]Service{
+			"frontend": {
+				Host:  "frontend.default.svc",
+				Ports: map[string]int{ProtocolHTTP: 80},
+				Calls: []Call{{Service: "backend", Protocol: ProtocolGRPC}},
+			},
+			"backend": {Protocols: []string{ProtocolUDP, ProtocolTCP, ProtocolGRPC, ProtocolHTTP}},
+			"cache":   {Protocols: []string{ProtocolTCP}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		basePort int
+		want     map[string]map[string]int
+		wantErr  bool
+	}{
+		{
+			name:     "ports in the order of the names and protocols",
+			basePort: 9000,
+			want: map[string]map[string]int{
+				"backend": {
+					ProtocolHTTP: 9000,
+					ProtocolGRPC: 9001,
+					ProtocolTCP:  9002,
+					ProtocolUDP:  9003,
+				},
+				"cache":    {ProtocolTCP: 9004},
+				"frontend": {ProtocolHTTP: 9005},
+			},
+		},
+		{
+			name:     "last port fits",
+			basePort: 65530,
+			want: map[string]map[string]int{
+				"backend": {
+					ProtocolHTTP: 65530,
+					ProtocolGRPC: 65531,
+					ProtocolTCP:  65532,
+					ProtocolUDP:  65533,
+				},
+				"cache":    {ProtocolTCP: 65534},
+				"frontend": {ProtocolHTTP: 65535},
+			},
+		},
+		{
+			name:     "ports overflow",
+			basePort: 65531,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			local, err := topology.Local("127.0.0.1", test.basePort)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ports := make(map[string]map[string]int)
+			for name, service := range local.Services {
+				if service.Host != "127.0.0.1" {
+					t.Errorf("service %q has host %q", name, service.Host)
+				}
+				ports[name] = service.Ports
+			}
+			if !reflect.DeepEqual(ports, test.want) {
+				t.Errorf("got ports %v, want %v", ports, test.want)
+			}
+
+			// the original topology is not modified
+			if topology.Services["frontend"].Host != "frontend.default.svc" || topology.Services["frontend"].Ports[ProtocolHTTP] != 80 {
+				t.Errorf("original topology was modified: %+v", topology.Services["frontend"])
+			}
+		})
+	}
+}
+
+func TestLocalRequests(t *testing.T) {
+	topology := Topology{
+		Services: map[string]Service{
+			"frontend": {
+				Calls: []Call{
+					{Service: "backend"},
+					{Service: "backend", Protocol: ProtocolGRPC, Count: 2},
+					{Service: "backend", Protocol: ProtocolWebSocket, Options: "messages=10"},
+					{Service: "backend", Protocol: ProtocolTCP, Options: "size=1KiB&mode=echo"},
+				},
+			},
+			"backend": {Protocols: []string{ProtocolHTTP, ProtocolGRPC, ProtocolTCP}},
+		},
+	}
+
+	local, err := topology.Local("127.0.0.1", 9000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests, err := local.Requests(local.Services["frontend"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"http://127.0.0.1:9000/#1",
+		"grpc://127.0.0.1:9001/allspark/Incoming#2",
+		"ws://127.0.0.1:9000/ws#1#messages=10",
+		"tcp://127.0.0.1:9002#1#size=1KiB&mode=echo",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %q, want %q", requests, want)
+	}
+}
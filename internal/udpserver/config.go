@@ -0,0 +1,67 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package udpserver
+
+import (
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/limiter"
+)
+
+const (
+	// ModeSink never responds to the datagrams
+	ModeSink = "sink"
+	// ModeEcho sends every datagram back to its sender
+	ModeEcho = "echo"
+	// ModeWorkload responds to every datagram with the output of the workload
+	ModeWorkload = "workload"
+)
+
+type Config struct {
+	ListenAddress string `mapstructure:"listenAddress"`
+
+	// Mode is how the server responds to the incoming datagrams
+	// Accepted values are: sink, echo, workload
+	Mode string `mapstructure:"mode"`
+
+	// Limits are the rate and concurrency limits of the incoming datagrams
+	Limits limiter.Config `mapstructure:"limits"`
+}
+
+// Validate checks that the configuration is valid.
+func (c Config) Validate() (Config, error) {
+	if c.ListenAddress == "" {
+		c.ListenAddress = "0.0.0.0:8084"
+	}
+
+	if c.Mode == "" {
+		c.Mode = ModeEcho
+	}
+
+	switch c.Mode {
+	case ModeSink, ModeEcho, ModeWorkload:
+	default:
+		return c, emperror.With(errors.New("invalid UDP server mode"), "mode", c.Mode)
+	}
+
+	limits, err := c.Limits.Validate()
+	if err != nil {
+		return c, errors.WrapIf(err, "invalid limits")
+	}
+	c.Limits = limits
+
+	return c, nil
+}
@@ -0,0 +1,256 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package udpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"emperror.dev/emperror"
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/fault"
+	"github.com/banzaicloud/allspark/internal/limiter"
+	"github.com/banzaicloud/allspark/internal/platform/log"
+	"github.com/banzaicloud/allspark/internal/request"
+	"github.com/banzaicloud/allspark/internal/sql"
+	"github.com/banzaicloud/allspark/internal/workload"
+)
+
+type Server struct {
+	requests request.Requests
+	workload workload.Workload
+
+	sqlCient *sql.Client
+
+	faultInjector *fault.Injector
+	limiter       *limiter.Limiter
+
+	listenAddress string
+	mode          string
+
+	mu         sync.Mutex
+	conn       net.PacketConn
+	inShutdown bool
+	wg         sync.WaitGroup
+
+	errorHandler emperror.Handler
+	logger       log.Logger
+}
+
+func New(config Config, logger log.Logger, errorHandler emperror.Handler) *Server {
+	logger = logger.WithField("server", "udp")
+	return &Server{
+		requests: make(request.Requests, 0),
+
+		listenAddress: config.ListenAddress,
+		mode:          config.Mode,
+		limiter:       limiter.New(config.Limits),
+
+		errorHandler: errorHandler,
+		logger:       logger,
+	}
+}
+
+func (s *Server) SetWorkload(workload workload.Workload) {
+	s.logger.WithField("name", workload.GetName()).Info("set workload")
+	s.workload = workload
+}
+
+func (s *Server) SetRequests(requests request.Requests) {
+	s.requests = requests
+}
+
+func (s *Server) SetSQLClient(client *sql.Client) {
+	s.sqlCient = client
+}
+
+func (s *Server) SetFaultInjector(injector *fault.Injector) {
+	s.faultInjector = injector
+}
+
+func (s *Server) Run() {
+	conn, err := net.ListenPacket("udp", s.listenAddress)
+	if err != nil {
+		s.errorHandler.Handle(errors.WrapIf(err, "could not listen"))
+		return
+	}
+
+	s.mu.Lock()
+	if s.inShutdown {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	s.logger.WithFields(log.Fields{
+		"address": s.listenAddress,
+		"mode":    s.mode,
+	}).Info("starting UDP server")
+
+	buf := make([]byte, request.UDPMaxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) && s.shuttingDown() {
+				return
+			}
+			s.errorHandler.Handle(errors.WrapIf(err, "could not read datagram"))
+			return
+		}
+
+		release, err := s.limiter.Acquire()
+		if err != nil {
+			s.logger.WithFields(log.Fields{
+				"from":  addr.String(),
+				"error": err.Error(),
+			}).Debug("datagram dropped")
+			continue
+		}
+
+		datagram := make([]byte, n)
+		copy(datagram, buf[:n])
+
+		if !s.track() {
+			release()
+			return
+		}
+		go func() {
+			defer s.wg.Done()
+			defer release()
+			s.Incoming(conn, addr, datagram)
+		}()
+	}
+}
+
+// Shutdown stops reading datagrams and waits for the in-flight ones to be handled
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down UDP server")
+
+	var err error
+	s.mu.Lock()
+	s.inShutdown = true
+	if s.conn != nil {
+		err = s.conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return errors.WrapIf(ctx.Err(), "could not drain UDP datagrams")
+	}
+}
+
+// track registers an in-flight datagram unless the server is shutting down
+func (s *Server) track() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return false
+	}
+	s.wg.Add(1)
+
+	return true
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inShutdown
+}
+
+func (s *Server) Incoming(conn net.PacketConn, addr net.Addr, datagram []byte) {
+	s.logger.WithFields(log.Fields{
+		"from":  addr.String(),
+		"bytes": len(datagram),
+	}).Debug("incoming UDP datagram")
+
+	if err := s.faultInjector.Inject(context.Background()); err != nil {
+		s.logger.WithField("error", err.Error()).Warn("fault injected")
+		return
+	}
+
+	// the datagram is handled until the subsequent requests are finished, so they are bounded by the limits
+	var requests sync.WaitGroup
+	defer requests.Wait()
+	requests.Add(1)
+	go func() {
+		defer requests.Done()
+		s.doRequests(nil)
+	}()
+
+	if s.sqlCient != nil {
+		go func() {
+			query, err := s.sqlCient.RunQuery(s.logger)
+			if err != nil {
+				s.logger.WithFields(log.Fields{
+					"query": query,
+				}).Error(err)
+			}
+		}()
+	}
+
+	var response []byte
+	if s.workload != nil {
+		output, _, err := s.workload.Execute()
+		if err != nil && !errors.Is(err, workload.ErrNoWorkload) {
+			s.errorHandler.Handle(errors.WrapIf(err, "could not run workload"))
+		}
+		response = []byte(output)
+	}
+
+	switch s.mode {
+	case ModeEcho:
+		response = datagram
+	case ModeSink:
+		return
+	}
+
+	if _, err := conn.WriteTo(response, addr); err != nil {
+		s.logger.Error(errors.WrapIf(err, "could not send response"))
+	}
+}
+
+func (s *Server) doRequests(incomingRequestHeaders http.Header) {
+	var wg sync.WaitGroup
+
+	// path conditions never match as there is no incoming path
+	for _, r := range s.requests.Select(request.Incoming{Headers: incomingRequestHeaders}) {
+		var i uint
+		for i = 0; i < r.Count(); i++ {
+			wg.Add(1)
+			go func(request request.Request) {
+				defer wg.Done()
+				request.Do(incomingRequestHeaders, s.logger)
+			}(r)
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,69 @@
+// Copyright © 2022 Banzai Cloud
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"sync"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
+// DynamicWorkload delegates to a workload that can be switched at runtime
+type DynamicWorkload struct {
+	mu       sync.RWMutex
+	workload Workload
+
+	logger log.Logger
+}
+
+func NewDynamicWorkload(workload Workload, logger log.Logger) *DynamicWorkload {
+	return &DynamicWorkload{
+		workload: workload,
+
+		logger: logger,
+	}
+}
+
+// Set switches the underlying workload, nil means no workload
+func (w *DynamicWorkload) Set(workload Workload) {
+	w.mu.Lock()
+	w.workload = workload
+	w.mu.Unlock()
+
+	w.logger.WithField("name", w.GetName()).Info("workload switched")
+}
+
+func (w *DynamicWorkload) GetName() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.workload == nil {
+		return ""
+	}
+
+	return w.workload.GetName()
+}
+
+func (w *DynamicWorkload) Execute() (string, string, error) {
+	w.mu.RLock()
+	workload := w.workload
+	w.mu.RUnlock()
+
+	if workload == nil {
+		return "", "", ErrNoWorkload
+	}
+
+	return workload.Execute()
+}
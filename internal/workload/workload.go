@@ -14,7 +14,42 @@
 
 package workload
 
+import (
+	"emperror.dev/errors"
+
+	"github.com/banzaicloud/allspark/internal/platform/log"
+)
+
 type Workload interface {
 	GetName() string
 	Execute() (string, string, error)
 }
+
+// ErrNoWorkload is returned by DynamicWorkload when no workload is set,
+// the servers respond the same way as without a workload
+var ErrNoWorkload = errors.NewPlain("no workload")
+
+// Config holds the settings of the available workloads
+type Config struct {
+	Name    string `json:"name" yaml:"name"`
+	EchoStr string `json:"echoStr" yaml:"echoStr"`
+	PICount int    `json:"piCount" yaml:"piCount"`
+}
+
+// New creates the workload specified by the config, returns nil if no name is set
+func New(config Config, logger log.Logger) (Workload, error) {
+	switch config.Name {
+	case "":
+		return nil, nil
+	case EchoWorkloadName:
+		return NewEchoWorkload(config.EchoStr, logger), nil
+	case PIWorkloadName:
+		count := config.PICount
+		if count < 1 {
+			count = 50000
+		}
+		return NewPIWorkload(uint(count), logger), nil
+	default:
+		return nil, errors.Errorf("invalid workload: '%s'", config.Name)
+	}
+}